@@ -0,0 +1,215 @@
+package tstsvc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ory/dockertest/v3"
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+var (
+	// Default tag of the built application image.
+	DefaultAppTag = "latest"
+
+	// Default container expire time of the application.
+	DefaultAppExpire uint = 120
+)
+
+// NetworkEnver is implemented by test resources which can be connected from other containers
+// in the same docker network.
+type NetworkEnver interface {
+	// NetworkEnv returns environment variables (e.g. "MYSQL_DSN") to connect to the resource from
+	// another container in the same docker network.
+	NetworkEnv() map[string]string
+}
+
+// AppResource represents an application container built from a Dockerfile.
+type AppResource struct {
+	// Application docker container.
+	*dockertest.Resource
+
+	// Actual options.
+	BuildOptions
+
+	tracker *Tracker
+}
+
+// BuildOptions is options to build and run an application image.
+type BuildOptions struct {
+	// Name (repository) of the built image. Required.
+	Name string
+
+	// Tag of the built image. Default: DefaultAppTag.
+	Tag string
+
+	// The build context directory. Required.
+	ContextDir string
+
+	// Path of the Dockerfile relative to ContextDir. Default: "Dockerfile".
+	Dockerfile string
+
+	// Build arguments.
+	BuildArgs map[string]string
+
+	// Images to consider as cache sources.
+	CacheFrom []string
+
+	// If true, docker build cache will not be used. Default: false.
+	NoCache bool
+
+	// If specified, the container will be attached to this network. Deps should be attached to it as well.
+	Network *dockertest.Network
+
+	// Environment variables returned by NetworkEnv of these resources are injected into the container.
+	Deps []NetworkEnver
+
+	// Extra environment variables in "KEY=VALUE" form, can override the ones from Deps.
+	Env []string
+
+	// If specified (e.g. "8080/tcp"), wait for the HTTP health endpoint on this container port
+	// responding 2xx before return. Default: "" (no waiting).
+	HealthPort string
+
+	// Path of the HTTP health endpoint. Default: "/".
+	HealthPath string
+
+	// Expire time (in seconds) of the container. Default: DefaultAppExpire.
+	Expire uint
+
+	// BaseRunOptions is the base options, will be overrided by above.
+	BaseRunOptions dockertest.RunOptions
+}
+
+// BuildAndRun builds an image from opts.ContextDir and runs it. If pool is nil, DefaultPool() will be used.
+func BuildAndRun(pool *dockertest.Pool, opts *BuildOptions) (*AppResource, error) {
+	// Handle nil case.
+	if pool == nil {
+		pool = DefaultPool()
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("tstsvc: BuildOptions is required")
+	}
+
+	// Collect options.
+	res := &AppResource{
+		BuildOptions: *opts,
+	}
+	opts = &res.BuildOptions
+
+	if opts.Name == "" {
+		return nil, fmt.Errorf("tstsvc: BuildOptions.Name is required")
+	}
+	if opts.ContextDir == "" {
+		return nil, fmt.Errorf("tstsvc: BuildOptions.ContextDir is required")
+	}
+	if opts.Tag == "" {
+		opts.Tag = DefaultAppTag
+	}
+	if opts.Dockerfile == "" {
+		opts.Dockerfile = "Dockerfile"
+	}
+	if opts.HealthPath == "" {
+		opts.HealthPath = "/"
+	}
+	if opts.Expire == 0 {
+		opts.Expire = DefaultAppExpire
+	}
+
+	// Build image.
+	buildArgs := []dc.BuildArg{}
+	for name, value := range opts.BuildArgs {
+		buildArgs = append(buildArgs, dc.BuildArg{Name: name, Value: value})
+	}
+	sort.Slice(buildArgs, func(i, j int) bool { return buildArgs[i].Name < buildArgs[j].Name })
+
+	if err := pool.Client.BuildImage(dc.BuildImageOptions{
+		Name:         fmt.Sprintf("%s:%s", opts.Name, opts.Tag),
+		Dockerfile:   opts.Dockerfile,
+		ContextDir:   opts.ContextDir,
+		BuildArgs:    buildArgs,
+		CacheFrom:    opts.CacheFrom,
+		NoCache:      opts.NoCache,
+		OutputStream: ioutil.Discard,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Copy and collect RunOptions.
+	runOpts := opts.BaseRunOptions
+	runOpts.Env = append([]string(nil), runOpts.Env...)
+	runOpts.Networks = append([]*dockertest.Network(nil), runOpts.Networks...)
+	runOpts.ExposedPorts = append([]string(nil), runOpts.ExposedPorts...)
+
+	runOpts.Repository = opts.Name
+	runOpts.Tag = opts.Tag
+	for _, dep := range opts.Deps {
+		env := dep.NetworkEnv()
+		keys := make([]string, 0, len(env))
+		for key := range env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			runOpts.Env = append(runOpts.Env, fmt.Sprintf("%s=%s", key, env[key]))
+		}
+	}
+	runOpts.Env = append(runOpts.Env, opts.Env...)
+	if opts.Network != nil {
+		runOpts.Networks = append(runOpts.Networks, opts.Network)
+	}
+	if opts.HealthPort != "" {
+		runOpts.ExposedPorts = append(runOpts.ExposedPorts, opts.HealthPort)
+	}
+
+	res.tracker = Track("app", runOpts.Repository, runOpts.Tag)
+
+	var err error
+	res.Resource, err = pool.RunWithOptions(&runOpts)
+	if err != nil {
+		return nil, err
+	}
+	res.tracker.Created(res.Resource)
+
+	// Set expire of the container.
+	res.Resource.Expire(opts.Expire)
+
+	// Wait.
+	if opts.HealthPort != "" {
+		if err := pool.Retry(func() error {
+			resp, err := http.Get(res.URL(opts.HealthPort) + opts.HealthPath)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return fmt.Errorf("tstsvc: health check got status %d", resp.StatusCode)
+			}
+			return nil
+		}); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	res.tracker.Ready(pool, res.Resource)
+
+	return res, nil
+}
+
+// Close removes the container.
+func (res *AppResource) Close() error {
+	return res.tracker.Close(res.Resource.Close)
+}
+
+// URL returns the http url (without trailing slash) to the given container port (e.g. "8080/tcp") from host.
+func (res *AppResource) URL(port string) string {
+	return fmt.Sprintf("http://localhost:%s", res.GetPort(port))
+}
+
+// ContainerName returns the name of the container, which can be used as host name inside docker networks.
+func ContainerName(res *dockertest.Resource) string {
+	return strings.TrimPrefix(res.Container.Name, "/")
+}
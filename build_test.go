@@ -0,0 +1,81 @@
+package tstsvc
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticEnver map[string]string
+
+func (e staticEnver) NetworkEnv() map[string]string {
+	return e
+}
+
+func TestBuildAndRun(t *testing.T) {
+	assert := assert.New(t)
+	var err error
+
+	// Create temp directory as build context.
+	tmpDir, err := ioutil.TempDir("/tmp", "tstsvc")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	log.Printf("Temp directory created: %s\n", tmpDir)
+
+	// A tiny http server which serves its environment.
+	dockerfile := `
+FROM busybox:1.32
+ARG GREETING
+RUN mkdir /www && echo "$GREETING" > /www/greeting
+CMD env > /www/env && httpd -f -p 8080 -h /www
+`
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "Dockerfile"), []byte(dockerfile), 0666); err != nil {
+		log.Panic(err)
+	}
+
+	network, err := DefaultPool().CreateNetwork("tstsvc-build-test")
+	if !assert.NoError(err) {
+		return
+	}
+	defer network.Close()
+
+	res, err := BuildAndRun(nil, &BuildOptions{
+		Name:       "tstsvc-build-test",
+		ContextDir: tmpDir,
+		BuildArgs:  map[string]string{"GREETING": "hello"},
+		Network:    network,
+		Deps:       []NetworkEnver{staticEnver{"DEP_ADDR": "dep:1234"}},
+		HealthPort: "8080/tcp",
+		HealthPath: "/greeting",
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	log.Printf("The application is up, url: %+q.\n", res.URL("8080/tcp"))
+
+	resp, err := http.Get(res.URL("8080/tcp") + "/env")
+	if !assert.NoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Contains(string(body), "DEP_ADDR=dep:1234")
+}
+
+func TestBuildAndRunOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := BuildAndRun(nil, nil)
+	assert.EqualError(err, "tstsvc: BuildOptions is required")
+	_, err = BuildAndRun(nil, &BuildOptions{ContextDir: "."})
+	assert.EqualError(err, "tstsvc: BuildOptions.Name is required")
+}
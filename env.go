@@ -0,0 +1,106 @@
+package tstsvc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Exporter is implemented by test resources which can export environment variables to connect to them
+// from host, e.g. for subprocesses.
+type Exporter interface {
+	// Export returns environment variables (e.g. "MYSQL_DSN") to connect to the resource.
+	Export() map[string]string
+}
+
+// ExporterFunc is an adapter to allow the use of ordinary functions as Exporter.
+type ExporterFunc func() map[string]string
+
+// Export implements Exporter.
+func (f ExporterFunc) Export() map[string]string {
+	return f()
+}
+
+// WithPrefix returns an Exporter which prefixes all variable names exported by e with prefix.
+// It's useful when there are multiple resources of the same kind, e.g. WithPrefix("ORDER_", res)
+// exports "ORDER_MYSQL_DSN".
+func WithPrefix(prefix string, e Exporter) Exporter {
+	return ExporterFunc(func() map[string]string {
+		ret := map[string]string{}
+		for key, value := range e.Export() {
+			ret[prefix+key] = value
+		}
+		return ret
+	})
+}
+
+// Env returns the merged environment variables exported by exporters in "KEY=VALUE" form, sorted by key.
+// Later exporters override earlier ones on the same key.
+func Env(exporters ...Exporter) []string {
+	vars := exportVars(exporters)
+	ret := make([]string, 0, len(vars))
+	for _, kv := range vars {
+		ret = append(ret, fmt.Sprintf("%s=%s", kv[0], kv[1]))
+	}
+	return ret
+}
+
+// SetCmdEnv appends environment variables exported by exporters to cmd.Env. If cmd.Env is nil,
+// it's initialized to os.Environ() first so that the subprocess still inherits the current environment.
+func SetCmdEnv(cmd *exec.Cmd, exporters ...Exporter) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, Env(exporters...)...)
+}
+
+// WriteDotEnv writes environment variables exported by exporters to a .env file.
+func WriteDotEnv(path string, exporters ...Exporter) error {
+	b := &strings.Builder{}
+	for _, kv := range exportVars(exporters) {
+		fmt.Fprintf(b, "%s=%s\n", kv[0], dotEnvQuote(kv[1]))
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// PrintExports writes environment variables exported by exporters to w as shell "export" lines.
+func PrintExports(w io.Writer, exporters ...Exporter) error {
+	for _, kv := range exportVars(exporters) {
+		if _, err := fmt.Fprintf(w, "export %s=%s\n", kv[0], shellQuote(kv[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportVars(exporters []Exporter) [][2]string {
+	vars := map[string]string{}
+	for _, e := range exporters {
+		for key, value := range e.Export() {
+			vars[key] = value
+		}
+	}
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make([][2]string, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, [2]string{key, vars[key]})
+	}
+	return ret
+}
+
+func dotEnvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func shellQuote(s string) string {
+	return `'` + strings.Replace(s, `'`, `'\''`, -1) + `'`
+}
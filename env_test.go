@@ -0,0 +1,78 @@
+package tstsvc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	e1 := ExporterFunc(func() map[string]string {
+		return map[string]string{
+			"MYSQL_DSN": "root:123456@tcp(localhost:3306)/tst",
+		}
+	})
+	e2 := ExporterFunc(func() map[string]string {
+		return map[string]string{
+			"NATS_URL": "nats://localhost:4222",
+			"QUOTED":   `it's "$HOME"`,
+		}
+	})
+
+	// Env.
+	assert.Equal([]string{
+		"MYSQL_DSN=root:123456@tcp(localhost:3306)/tst",
+		"NATS_URL=nats://localhost:4222",
+		`QUOTED=it's "$HOME"`,
+	}, Env(e1, e2))
+
+	// Prefix.
+	assert.Equal([]string{
+		"X_MYSQL_DSN=root:123456@tcp(localhost:3306)/tst",
+	}, Env(WithPrefix("X_", e1)))
+
+	// Shell export lines.
+	buf := &bytes.Buffer{}
+	assert.NoError(PrintExports(buf, e2))
+	assert.Equal("export NATS_URL='nats://localhost:4222'\nexport QUOTED='it'\\''s \"$HOME\"'\n", buf.String())
+
+	// Shell should get back the same value.
+	{
+		cmd := exec.Command("sh", "-c", buf.String()+`printf %s "$QUOTED"`)
+		out, err := cmd.Output()
+		assert.NoError(err)
+		assert.Equal(`it's "$HOME"`, string(out))
+	}
+
+	// Subprocess environment.
+	{
+		cmd := exec.Command("sh", "-c", `printf %s "$NATS_URL"`)
+		SetCmdEnv(cmd, e2)
+		out, err := cmd.Output()
+		assert.NoError(err)
+		assert.Equal("nats://localhost:4222", string(out))
+	}
+
+	// .env file.
+	{
+		tmpDir, err := ioutil.TempDir("/tmp", "tstsvc")
+		if err != nil {
+			log.Panic(err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		path := filepath.Join(tmpDir, ".env")
+		assert.NoError(WriteDotEnv(path, e2))
+		content, err := ioutil.ReadFile(path)
+		assert.NoError(err)
+		assert.Equal("NATS_URL=\"nats://localhost:4222\"\nQUOTED=\"it's \\\"\\$HOME\\\"\"\n", string(content))
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/huangjunwen/tstsvc
 
-go 1.15
+go 1.16
 
 require (
 	github.com/Microsoft/go-winio v0.5.0 // indirect
@@ -17,5 +17,5 @@ require (
 	github.com/ory/dockertest/v3 v3.7.0
 	github.com/stretchr/testify v1.6.1
 	github.com/xeipuuv/gojsonpointer v0.0.0-20190905194746-02993c407bfb // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
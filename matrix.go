@@ -0,0 +1,67 @@
+package tstsvc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// MatrixEnv returns the name of the environment variable to override the tag matrix of a service,
+// e.g. "TSTSVC_MYSQL_TAGS" for service "mysql".
+func MatrixEnv(service string) string {
+	return fmt.Sprintf("TSTSVC_%s_TAGS", strings.ToUpper(service))
+}
+
+// MatrixTags returns the tags to test against for a service. If environment variable MatrixEnv(service)
+// is not empty, it is treated as a comma separated tag list and overrides tags. If both are empty,
+// defaultTag is used.
+func MatrixTags(service string, tags []string, defaultTag string) []string {
+	if env := os.Getenv(MatrixEnv(service)); env != "" {
+		tags = nil
+		for _, tag := range strings.Split(env, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		tags = []string{defaultTag}
+	}
+	return tags
+}
+
+// Matrix runs f as a subtest (named by tag) for each tag returned by MatrixTags.
+// If parallel is true, the subtests are run in parallel.
+func Matrix(t *testing.T, service string, tags []string, defaultTag string, parallel bool, f func(t *testing.T, tag string)) {
+	for _, tag := range MatrixTags(service, tags, defaultTag) {
+		tag := tag
+		t.Run(tag, func(t *testing.T) {
+			if parallel {
+				t.Parallel()
+			}
+			f(t, tag)
+		})
+	}
+}
+
+// MatrixResources is like Matrix, but for each subtest it runs a test resource of the tag by run, passes it to
+// f, and closes it after f returned. Errors of run fail the subtest and errors of closing are reported by
+// t.Errorf. It's used to implement Matrix of service packages.
+func MatrixResources(t *testing.T, service string, tags []string, defaultTag string, parallel bool,
+	run func(tag string) (io.Closer, error), f func(t *testing.T, res io.Closer)) {
+	Matrix(t, service, tags, defaultTag, parallel, func(t *testing.T, tag string) {
+		res, err := run(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := res.Close(); err != nil {
+				t.Errorf("tstsvc: close %s:%s error: %s", service, tag, err)
+			}
+		}()
+		f(t, res)
+	})
+}
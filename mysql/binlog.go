@@ -0,0 +1,100 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+var (
+	// Default replication user name when Options.Binlog is true.
+	DefaultReplUser = "repl"
+
+	// Default password of the replication user.
+	DefaultReplPassword = "repl123456"
+
+	// Default server_id when Options.Binlog is true.
+	DefaultServerID uint32 = 1
+)
+
+// BinlogPosition is the current binlog coordinates of a MySQL server.
+type BinlogPosition struct {
+	// Current binlog file name.
+	File string
+
+	// Current position in File.
+	Position uint32
+
+	// Executed GTID set.
+	GTIDSet string
+}
+
+// binlogVariables returns server variables to enable binlog: ROW format, full row image and GTID mode.
+// vars overrides them.
+func binlogVariables(vars map[string]string, serverID uint32) map[string]string {
+	ret := map[string]string{
+		"server_id":                fmt.Sprintf("%d", serverID),
+		"log_bin":                  "mysql-bin",
+		"log_slave_updates":        "ON",
+		"binlog_format":            "ROW",
+		"binlog_row_image":         "FULL",
+		"gtid_mode":                "ON",
+		"enforce_gtid_consistency": "ON",
+	}
+	for name, value := range vars {
+		ret[name] = value
+	}
+	return ret
+}
+
+// createReplUser creates the replication user without writing the binlog.
+func (res *Resource) createReplUser(ctx context.Context) error {
+	return res.exec(ctx,
+		"SET SQL_LOG_BIN=0",
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %s IDENTIFIED WITH mysql_native_password BY %s",
+			quoteAccount(res.Options.ReplUser, "%"), quoteString(res.Options.ReplPassword)),
+		fmt.Sprintf("GRANT SELECT, RELOAD, SHOW DATABASES, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO %s",
+			quoteAccount(res.Options.ReplUser, "%")),
+		"SET SQL_LOG_BIN=1",
+	)
+}
+
+// BinlogPosition returns the current binlog coordinates and executed GTID set. Options.Binlog must be true.
+func (res *Resource) BinlogPosition(ctx context.Context) (*BinlogPosition, error) {
+	if !res.Options.Binlog {
+		return nil, fmt.Errorf("tstmysql: Options.Binlog is not enabled")
+	}
+
+	db, err := res.rootClient()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var (
+		ret                 BinlogPosition
+		doDB, ignoreDB, set sql.NullString
+	)
+	if err := db.QueryRowContext(ctx, "SHOW MASTER STATUS").Scan(&ret.File, &ret.Position, &doDB, &ignoreDB, &set); err != nil {
+		return nil, err
+	}
+	ret.GTIDSet = set.String
+	return &ret, nil
+}
+
+// ReplDSN returns the data source name (as the replication user, without database) of the test MySQL server,
+// which can be used by CDC tools to read the binlog. It returns "" if Options.Binlog is false.
+func (res *Resource) ReplDSN() string {
+	if !res.Options.Binlog {
+		return ""
+	}
+	return res.localDSN(res.Options.ReplUser, res.Options.ReplPassword, "")
+}
+
+// NetworkReplDSN is like ReplDSN but to connect from another container in the same docker network.
+func (res *Resource) NetworkReplDSN() string {
+	if !res.Options.Binlog {
+		return ""
+	}
+	return res.dsn(res.Options.ReplUser, res.Options.ReplPassword, res.networkAddr(), "")
+}
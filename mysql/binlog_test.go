@@ -0,0 +1,79 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinlogVariables(t *testing.T) {
+	assert := assert.New(t)
+
+	vars := binlogVariables(map[string]string{
+		"binlog_row_image": "MINIMAL",
+		"sql_mode":         "",
+	}, 3)
+	assert.Equal("3", vars["server_id"])
+	assert.Equal("ROW", vars["binlog_format"])
+	assert.Equal("ON", vars["gtid_mode"])
+	// Overrided.
+	assert.Equal("MINIMAL", vars["binlog_row_image"])
+	assert.Contains(vars, "sql_mode")
+}
+
+func TestBinlog(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		Binlog:   true,
+		ServerID: 42,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	vars, err := res.Variables(ctx, "server_id", "binlog_format", "binlog_row_image", "gtid_mode")
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		"server_id":        "42",
+		"binlog_format":    "ROW",
+		"binlog_row_image": "FULL",
+		"gtid_mode":        "ON",
+	}, vars)
+
+	pos1, err := res.BinlogPosition(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotEmpty(pos1.File)
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE xxx (id INT PRIMARY KEY)")
+	assert.NoError(err)
+
+	pos2, err := res.BinlogPosition(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(pos2.Position > pos1.Position || pos2.File != pos1.File)
+	assert.NotEqual(pos1.GTIDSet, pos2.GTIDSet)
+
+	// The replication user can read binlog status.
+	replDB, err := sql.Open("mysql", res.ReplDSN())
+	if !assert.NoError(err) {
+		return
+	}
+	defer replDB.Close()
+	rows, err := replDB.Query("SHOW BINARY LOGS")
+	if assert.NoError(err) {
+		rows.Close()
+	}
+}
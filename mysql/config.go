@@ -0,0 +1,122 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// serverVariableArgs converts server variables to mysqld command line options, sorted by name.
+func serverVariableArgs(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, fmt.Sprintf("--%s=%s", strings.Replace(name, "_", "-", -1), vars[name]))
+	}
+	return ret
+}
+
+// myCnfFiles returns option files (name to content) of MyCnf/MyCnfFS.
+func (res *Resource) myCnfFiles() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if res.Options.MyCnfFS != nil {
+		names, err := fs.Glob(res.Options.MyCnfFS, "*.cnf")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(res.Options.MyCnfFS, name)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = data
+		}
+	}
+	if res.Options.MyCnf != "" {
+		// Prefix "zz" to make it the last one to load.
+		files["zz-tstmysql.cnf"] = []byte(res.Options.MyCnf)
+	}
+	return files, nil
+}
+
+// myCnfMounts writes MyCnf/MyCnfFS to a temporary directory and returns mounts of them into the option file
+// directory of the flavor.
+func (res *Resource) myCnfMounts() ([]string, error) {
+	files, err := res.myCnfFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	dir, err := res.tempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []string{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		// NOTE: mysqld ignores world-writable option files.
+		if err := ioutil.WriteFile(path, files[name], 0644); err != nil {
+			return nil, err
+		}
+		ret = append(ret, fmt.Sprintf("%s:%s/%s:ro", path, res.flavor.confDir, name))
+	}
+	return ret, nil
+}
+
+// Variables returns effective global server variables. If names are specified, only those variables are returned.
+// Both "_" and "-" are accepted in names, while the keys in result always use "_".
+func (res *Resource) Variables(ctx context.Context, names ...string) (map[string]string, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SHOW GLOBAL VARIABLES"
+	args := []interface{}{}
+	if len(names) != 0 {
+		placeholders := make([]string, len(names))
+		for i, name := range names {
+			placeholders[i] = "?"
+			args = append(args, strings.Replace(name, "-", "_", -1))
+		}
+		query += fmt.Sprintf(" WHERE Variable_name IN (%s)", strings.Join(placeholders, ", "))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := map[string]string{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		ret[name] = value.String
+	}
+	return ret, rows.Err()
+}
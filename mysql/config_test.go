@@ -0,0 +1,48 @@
+package tstmysql
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerVariableArgs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"--max-connections=500",
+		"--sql-mode=STRICT_ALL_TABLES,NO_ZERO_DATE",
+	}, serverVariableArgs(map[string]string{
+		"sql_mode":        "STRICT_ALL_TABLES,NO_ZERO_DATE",
+		"max_connections": "500",
+	}))
+}
+
+func TestServerConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		ServerVariables: map[string]string{
+			"sql_mode":        "STRICT_ALL_TABLES",
+			"max_connections": "321",
+		},
+		MyCnfFS: fstest.MapFS{
+			"charset.cnf": &fstest.MapFile{Data: []byte("[mysqld]\ncharacter-set-server=latin1\n")},
+		},
+		MyCnf: "[mysqld]\nwait_timeout=1234\n",
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	vars, err := res.Variables(context.Background(), "sql_mode", "max-connections", "character_set_server", "wait_timeout")
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		"sql_mode":             "STRICT_ALL_TABLES",
+		"max_connections":      "321",
+		"character_set_server": "latin1",
+		"wait_timeout":         "1234",
+	}, vars)
+}
@@ -0,0 +1,211 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/huangjunwen/tstsvc"
+)
+
+// Database is an isolated database on the test MySQL server created by Resource.NewDatabase.
+type Database struct {
+	// Name of the database.
+	Name string
+
+	// Client (as root) to the database.
+	DB *sql.DB
+
+	res *Resource
+}
+
+// NewDatabase creates a uniquely named database cloned (both schema and data) from a template, which is
+// built once from DBName (i.e. after HostInitSQLPath loaded) when the first time NewDatabase is called.
+// The database is dropped when t finished, so that parallel tests can share one MySQL server without
+// interfering each other.
+// NOTE: Only tables are cloned, views/triggers/routines are not.
+func (res *Resource) NewDatabase(t testing.TB) *Database {
+	t.Helper()
+	ctx := context.Background()
+
+	res.templateOnce.Do(func() {
+		if res.templateErr = res.dropDatabase(ctx, res.templateDBName()); res.templateErr != nil {
+			return
+		}
+		res.templateErr = res.cloneDatabase(ctx, res.Options.DBName, res.templateDBName())
+	})
+	if res.templateErr != nil {
+		t.Fatalf("tstmysql: build template database error: %s", res.templateErr)
+	}
+
+	name := fmt.Sprintf("%s_%s", res.Options.DBName, strings.ToLower(tstsvc.RandomString(10)))
+	if err := res.cloneDatabase(ctx, res.templateDBName(), name); err != nil {
+		t.Fatalf("tstmysql: clone database error: %s", err)
+	}
+
+	db, err := sql.Open("mysql", res.DatabaseDSN(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		if err := res.dropDatabase(ctx, name); err != nil {
+			t.Errorf("tstmysql: drop database %+q error: %s", name, err)
+		}
+	})
+
+	return &Database{
+		Name: name,
+		DB:   db,
+		res:  res,
+	}
+}
+
+// DSN returns the data source name (as root) of the database.
+func (d *Database) DSN() string {
+	return d.res.DatabaseDSN(d.Name)
+}
+
+// DatabaseDSN returns the data source name (as root) of the given database of the test MySQL server.
+func (res *Resource) DatabaseDSN(dbName string) string {
+	return res.withFakeTime(res.localConfig("root", res.Options.RootPassword, dbName)).FormatDSN()
+}
+
+func (res *Resource) templateDBName() string {
+	return res.Options.DBName + "_tpl"
+}
+
+// cloneDatabase creates database dst with the same tables (and data) as database src.
+func (res *Resource) cloneDatabase(ctx context.Context, src, dst string) error {
+	db, err := sql.Open("mysql", res.localDSN("root", res.Options.RootPassword, src))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// All statements must be executed in the same connection since foreign_key_checks is a session variable.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tables, err := listTables(ctx, conn, src)
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		"SET foreign_key_checks=0",
+		fmt.Sprintf("CREATE DATABASE %s", quoteIdent(dst)),
+		fmt.Sprintf("USE %s", quoteIdent(dst)),
+	}
+	for _, table := range tables {
+		var name, create string
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s", quoteIdent(table))).Scan(&name, &create); err != nil {
+			return err
+		}
+		// NOTE: Generated columns can't be inserted explicitly.
+		columns, err := listInsertableColumns(ctx, conn, src, table)
+		if err != nil {
+			return err
+		}
+		for i, column := range columns {
+			columns[i] = quoteIdent(column)
+		}
+		list := strings.Join(columns, ", ")
+		stmts = append(stmts,
+			create,
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s.%s", quoteIdent(table), list, list, quoteIdent(src), quoteIdent(table)),
+		)
+	}
+	stmts = append(stmts, "SET foreign_key_checks=1")
+
+	for i, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			// Do not leave a half-built database behind.
+			if i > 1 {
+				conn.ExecContext(context.Background(), fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteIdent(dst)))
+			}
+			return fmt.Errorf("%s: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+func (res *Resource) dropDatabase(ctx context.Context, name string) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteIdent(name)))
+	return err
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// listTables returns base tables of the database.
+func listTables(ctx context.Context, q queryer, dbName string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT TABLE_NAME FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA=? AND TABLE_TYPE='BASE TABLE'
+		ORDER BY TABLE_NAME`, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		ret = append(ret, table)
+	}
+	return ret, rows.Err()
+}
+
+// listInsertableColumns lists non-generated columns of the table in order.
+func listInsertableColumns(ctx context.Context, q queryer, dbName, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND EXTRA NOT LIKE '%GENERATED%'
+		ORDER BY ORDINAL_POSITION`, dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		ret = append(ret, column)
+	}
+	return ret, rows.Err()
+}
+
+// quoteIdent quotes an identifier with backquotes.
+func quoteIdent(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+// quoteString quotes s as a string literal.
+func quoteString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// quoteAccount quotes a user account.
+func quoteAccount(user, host string) string {
+	return quoteString(user) + "@" + quoteString(host)
+}
@@ -0,0 +1,95 @@
+package tstmysql
+
+import (
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("`abc`", quoteIdent("abc"))
+	assert.Equal("`a``b`", quoteIdent("a`b"))
+	assert.Equal(`'a''b\\c'`, quoteString(`a'b\c`))
+	assert.Equal(`'repl'@'%'`, quoteAccount("repl", "%"))
+}
+
+func TestNewDatabase(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	// Prepare the template.
+	{
+		db, err := res.Client()
+		if !assert.NoError(err) {
+			return
+		}
+		_, err = db.Exec(`CREATE TABLE xxx (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(64) NOT NULL,
+			upper_name VARCHAR(64) AS (UPPER(name)) VIRTUAL
+		)`)
+		assert.NoError(err)
+		_, err = db.Exec(`INSERT INTO xxx (name) VALUES ("ada")`)
+		assert.NoError(err)
+		db.Close()
+	}
+
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			i := i
+			t.Run(fmt.Sprintf("db%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				d := res.NewDatabase(t)
+				log.Printf("Database %+q created, DSN: %+q.\n", d.Name, d.DSN())
+
+				for j := 0; j < i; j++ {
+					if _, err := d.DB.Exec(`INSERT INTO xxx (name) VALUES ("bob")`); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				var n int
+				if err := d.DB.QueryRow("SELECT COUNT(*) FROM xxx").Scan(&n); err != nil {
+					t.Fatal(err)
+				}
+				if n != 1+i {
+					t.Errorf("Expect %d rows but got %d", 1+i, n)
+				}
+
+				// Generated columns are computed in the clone.
+				var upperName string
+				if err := d.DB.QueryRow("SELECT upper_name FROM xxx WHERE id=1").Scan(&upperName); err != nil {
+					t.Fatal(err)
+				}
+				if upperName != "ADA" {
+					t.Errorf("Expect %+q but got %+q", "ADA", upperName)
+				}
+			})
+		}
+	})
+
+	// All databases should be dropped.
+	{
+		db, err := res.Client()
+		if !assert.NoError(err) {
+			return
+		}
+		defer db.Close()
+
+		var n int
+		assert.NoError(db.QueryRow(
+			"SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME LIKE ?",
+			res.Options.DBName+"\\_%",
+		).Scan(&n))
+		assert.Equal(1, n) // Only the template.
+	}
+}
@@ -0,0 +1,40 @@
+package tstmysql
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Dump writes a logical backup (by mysqldump inside the container) of DBName to w: the given tables, or all
+// tables (and routines) if none is given. GTID and date information is not dumped so that the output can be
+// restored on another server and compared across runs. mysqldump is killed if ctx is done.
+func (res *Resource) Dump(ctx context.Context, w io.Writer, tables ...string) error {
+	if res.Options.Flavor == TiDB {
+		return fmt.Errorf("tstmysql: Dump is not supported by flavor %s", res.Options.Flavor)
+	}
+	cmd := []string{
+		"mysqldump",
+		"-uroot",
+		"--single-transaction",
+		"--skip-dump-date",
+	}
+	if res.Options.Flavor != MariaDB {
+		cmd = append(cmd, "--set-gtid-purged=OFF")
+	}
+	if len(tables) == 0 {
+		cmd = append(cmd, "--routines")
+	}
+	cmd = append(cmd, res.Options.DBName)
+	cmd = append(cmd, tables...)
+	return res.execContainerContext(ctx, cmd, nil, w)
+}
+
+// Restore executes SQL statements from r (e.g. output of Dump) by mysql inside the container (as root, in
+// DBName). mysql is killed if ctx is done, leaving statements executed so far applied.
+func (res *Resource) Restore(ctx context.Context, r io.Reader) error {
+	if res.Options.Flavor == TiDB {
+		return fmt.Errorf("tstmysql: Restore is not supported by flavor %s", res.Options.Flavor)
+	}
+	return res.execContainerContext(ctx, []string{"mysql", "-uroot", res.Options.DBName}, r, nil)
+}
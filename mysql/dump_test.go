@@ -0,0 +1,86 @@
+package tstmysql
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := &Resource{}
+	assert.Equal(context.Canceled, res.Dump(ctx, &bytes.Buffer{}))
+	assert.Equal(context.Canceled, res.Restore(ctx, &bytes.Buffer{}))
+}
+
+func TestDumpRestore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	src, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			CREATE TABLE yyy (id INT PRIMARY KEY);
+			INSERT INTO xxx (name) VALUES ('ada'), ('bob');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer src.Close()
+
+	dump := &bytes.Buffer{}
+	if !assert.NoError(src.Dump(ctx, dump, "xxx")) {
+		return
+	}
+	log.Printf("Dump:\n%s\n", dump.String())
+
+	dst, err := Run(nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer dst.Close()
+	assert.NoError(dst.Restore(ctx, dump))
+
+	db, err := dst.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	var n int
+	assert.NoError(db.QueryRow("SELECT COUNT(*) FROM xxx").Scan(&n))
+	assert.Equal(2, n)
+
+	// Only the given tables are dumped.
+	_, err = db.Exec("SELECT * FROM yyy")
+	assert.Error(err)
+
+	// Bad SQL.
+	assert.Error(dst.Restore(ctx, bytes.NewBufferString("SELEC 1;")))
+
+	// Killed on timeout.
+	{
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		start := time.Now()
+		assert.Equal(context.DeadlineExceeded, dst.Restore(ctx, bytes.NewBufferString("SELECT SLEEP(30);")))
+		assert.True(time.Since(start) < 10*time.Second)
+	}
+
+	// Finished before the deadline.
+	{
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		assert.NoError(dst.Restore(ctx, bytes.NewBufferString("SELECT 1;")))
+	}
+}
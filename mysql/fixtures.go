@@ -0,0 +1,339 @@
+package tstmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// Layout of the time returned by template function "now" in fixtures.
+	FixtureTimeLayout = "2006-01-02 15:04:05.000000"
+)
+
+const (
+	// fixtureLabelKey is the special key of a fixture row to label it for referencing.
+	fixtureLabelKey = "_label"
+
+	// csvNull represents NULL in CSV fixtures.
+	csvNull = `\N`
+)
+
+// Fixtures is a set of table fixtures, see LoadFixtures.
+type Fixtures struct {
+	tables []*fixtureTable
+	refs   map[string]int64
+}
+
+type fixtureTable struct {
+	name string
+	file string
+	rows []*fixtureRow
+}
+
+type fixtureRow struct {
+	label   string
+	columns []string
+	values  []interface{}
+}
+
+// LoadFixtures loads fixture files matching patterns (see fs.Glob) in fsys. Each file contains rows of a table,
+// the table name is the file name without extension. Supported formats:
+//
+//   - ".yml"/".yaml"/".json": A list of rows, each row is a mapping from column name to value.
+//     Nested values (mappings/lists) are encoded as JSON.
+//   - ".csv": The first record is the header of column names, `\N` represents NULL.
+//
+// A row can be labeled by the special column "_label", then other rows can reference its auto increment id
+// by the template function "ref". String values containing "{{" are treated as text/template with
+// functions:
+//
+//   - {{ ref "label" }}: the auto increment id of the labeled row, which must be loaded before.
+//   - {{ now }}: the current time when loading, formatted by FixtureTimeLayout.
+//   - {{ nowAdd "-24h" }}: the current time plus a duration.
+//
+// Files are loaded in the order of patterns, and files matching the same pattern are in lexical order.
+func LoadFixtures(fsys fs.FS, patterns ...string) (*Fixtures, error) {
+	ret := &Fixtures{}
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			table, err := parseFixture(name, data)
+			if err != nil {
+				return nil, fmt.Errorf("tstmysql: parse fixture %s: %s", name, err)
+			}
+			ret.tables = append(ret.tables, table)
+		}
+	}
+	return ret, nil
+}
+
+func parseFixture(name string, data []byte) (*fixtureTable, error) {
+	ext := path.Ext(name)
+	table := &fixtureTable{
+		name: strings.TrimSuffix(path.Base(name), ext),
+		file: name,
+	}
+
+	switch strings.ToLower(ext) {
+	case ".yml", ".yaml", ".json":
+		// NOTE: JSON is a subset of YAML, and yaml.MapSlice keeps the order of columns.
+		rows := []yaml.MapSlice{}
+		if err := yaml.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+		for i, r := range rows {
+			row := &fixtureRow{}
+			for _, item := range r {
+				column := fmt.Sprint(item.Key)
+				if column == fixtureLabelKey {
+					row.label = fmt.Sprint(item.Value)
+					continue
+				}
+				value, err := fixtureValue(item.Value)
+				if err != nil {
+					return nil, fmt.Errorf("row %d column %+q: %s", i, column, err)
+				}
+				row.columns = append(row.columns, column)
+				row.values = append(row.values, value)
+			}
+			table.rows = append(table.rows, row)
+		}
+
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return table, nil
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := &fixtureRow{}
+			for i, column := range header {
+				value := interface{}(record[i])
+				if record[i] == csvNull {
+					value = nil
+				}
+				if column == fixtureLabelKey {
+					row.label = record[i]
+					continue
+				}
+				row.columns = append(row.columns, column)
+				row.values = append(row.values, value)
+			}
+			table.rows = append(table.rows, row)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %+q", ext)
+	}
+
+	return table, nil
+}
+
+// fixtureValue converts a decoded yaml value to a value suitable for sql args.
+func fixtureValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case yaml.MapSlice, []interface{}, map[interface{}]interface{}:
+		data, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	default:
+		return v, nil
+	}
+}
+
+// jsonValue converts yaml mappings to values which can be marshaled by encoding/json.
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case yaml.MapSlice:
+		m := map[string]interface{}{}
+		for _, item := range val {
+			m[fmt.Sprint(item.Key)] = jsonValue(item.Value)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range val {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, item := range val {
+			l[i] = jsonValue(item)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// Tables returns the names of fixture tables in loading order.
+func (f *Fixtures) Tables() []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, table := range f.tables {
+		if !seen[table.name] {
+			seen[table.name] = true
+			ret = append(ret, table.name)
+		}
+	}
+	return ret
+}
+
+// Load resets fixture tables in db (truncates them, which also resets auto increments) and inserts fixture rows
+// with foreign key checks disabled. It can be called repeatedly to reset tables to the fixture state between tests.
+func (f *Fixtures) Load(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET foreign_key_checks=0"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SET foreign_key_checks=1")
+
+	for _, table := range f.Tables() {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s", quoteIdent(table))); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	f.refs = map[string]int64{}
+	funcs := template.FuncMap{
+		"ref": func(label string) (int64, error) {
+			id, ok := f.refs[label]
+			if !ok {
+				return 0, fmt.Errorf("unknown ref %+q", label)
+			}
+			return id, nil
+		},
+		"now": func() string {
+			return now.Format(FixtureTimeLayout)
+		},
+		"nowAdd": func(d string) (string, error) {
+			duration, err := time.ParseDuration(d)
+			if err != nil {
+				return "", err
+			}
+			return now.Add(duration).Format(FixtureTimeLayout), nil
+		},
+	}
+
+	for _, table := range f.tables {
+		for i, row := range table.rows {
+			if err := f.insertRow(ctx, conn, table, row, funcs); err != nil {
+				return fmt.Errorf("tstmysql: load fixture %s row %d: %s", table.file, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixtures) insertRow(ctx context.Context, conn *sql.Conn, table *fixtureTable, row *fixtureRow, funcs template.FuncMap) error {
+	columns := make([]string, len(row.columns))
+	placeholders := make([]string, len(row.columns))
+	values := make([]interface{}, len(row.values))
+	for i, column := range row.columns {
+		columns[i] = quoteIdent(column)
+		placeholders[i] = "?"
+		values[i] = row.values[i]
+
+		s, ok := values[i].(string)
+		if !ok || !strings.Contains(s, "{{") {
+			continue
+		}
+		tmpl, err := template.New(column).Funcs(funcs).Parse(s)
+		if err != nil {
+			return err
+		}
+		buf := &strings.Builder{}
+		if err := tmpl.Execute(buf, nil); err != nil {
+			return err
+		}
+		values[i] = buf.String()
+	}
+
+	result, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table.name),
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "),
+	), values...)
+	if err != nil {
+		return err
+	}
+
+	if row.label != "" {
+		if _, ok := f.refs[row.label]; ok {
+			return fmt.Errorf("duplicate label %+q", row.label)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		// Explicit id.
+		if id == 0 {
+			for i, column := range row.columns {
+				if column == "id" {
+					id, _ = strconv.ParseInt(fmt.Sprint(values[i]), 10, 64)
+				}
+			}
+		}
+		f.refs[row.label] = id
+	}
+	return nil
+}
+
+// Ref returns the auto increment id of the labeled row after Load.
+func (f *Fixtures) Ref(label string) (int64, bool) {
+	id, ok := f.refs[label]
+	return id, ok
+}
+
+// Labels returns all labels after Load, sorted.
+func (f *Fixtures) Labels() []string {
+	ret := make([]string, 0, len(f.refs))
+	for label := range f.refs {
+		ret = append(ret, label)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// LoadFixtures loads fixtures into DBName of the test MySQL server, see Fixtures.Load.
+func (res *Resource) LoadFixtures(ctx context.Context, f *Fixtures) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return f.Load(ctx, db)
+}
@@ -0,0 +1,111 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFixtures(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := LoadFixtures(os.DirFS("testdata/fixtures"), "users.yml", "posts.csv", "tags.json")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"users", "posts", "tags"}, f.Tables())
+
+	users := f.tables[0]
+	if assert.Len(users.rows, 2) {
+		assert.Equal("ada", users.rows[0].label)
+		assert.Equal([]string{"name", "profile", "created_at"}, users.rows[0].columns)
+		assert.Equal(`{"langs":["go","sql"]}`, users.rows[0].values[1])
+		assert.Nil(users.rows[1].values[1])
+	}
+
+	posts := f.tables[1]
+	if assert.Len(posts.rows, 2) {
+		assert.Equal("p2", posts.rows[1].label)
+		assert.Equal([]string{"user_id", "title"}, posts.rows[1].columns)
+		assert.Nil(posts.rows[1].values[1])
+	}
+
+	_, err = LoadFixtures(os.DirFS("testdata"), "migrations/*.sql")
+	assert.Error(err)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL,
+				profile JSON,
+				created_at DATETIME(6) NOT NULL
+			);
+			CREATE TABLE posts (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id INT UNSIGNED NOT NULL,
+				title VARCHAR(64),
+				FOREIGN KEY (user_id) REFERENCES users (id)
+			);
+			CREATE TABLE tags (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				post_id INT UNSIGNED NOT NULL,
+				name VARCHAR(64) NOT NULL,
+				FOREIGN KEY (post_id) REFERENCES posts (id)
+			);
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	f, err := LoadFixtures(os.DirFS("testdata/fixtures"), "users.yml", "posts.csv", "tags.json")
+	if !assert.NoError(err) {
+		return
+	}
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	// Load twice, the second one should reset the tables.
+	for i := 0; i < 2; i++ {
+		assert.NoError(res.LoadFixtures(ctx, f))
+
+		var n int
+		assert.NoError(db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&n))
+		assert.Equal(2, n)
+
+		bob, ok := f.Ref("bob")
+		assert.True(ok)
+		assert.Equal(int64(2), bob)
+
+		t1, ok := f.Ref("t1")
+		assert.True(ok)
+		assert.Equal(int64(10), t1)
+
+		var title sql.NullString
+		var name string
+		assert.NoError(db.QueryRow(`
+			SELECT posts.title, users.name FROM posts JOIN users ON posts.user_id=users.id
+			WHERE users.id=?`, bob).Scan(&title, &name))
+		assert.False(title.Valid)
+		assert.Equal("bob", name)
+
+		// Insert extra row.
+		_, err := db.Exec("INSERT INTO users (name, created_at) VALUES ('cat', NOW())")
+		assert.NoError(err)
+	}
+	assert.Equal([]string{"ada", "bob", "p1", "p2", "t1"}, f.Labels())
+}
@@ -0,0 +1,190 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Flavor is a MySQL compatible server implementation.
+type Flavor string
+
+const (
+	// The official MySQL server.
+	MySQL Flavor = "mysql"
+
+	// MariaDB server.
+	MariaDB Flavor = "mariadb"
+
+	// Percona server for MySQL.
+	Percona Flavor = "percona"
+
+	// TiDB (with the embedded storage). It has no root password initially and does not accept mysqld options,
+	// so DBName, User and passwords are setup by SQL after it's up.
+	TiDB Flavor = "tidb"
+)
+
+var (
+	// Docker repository of MariaDB.
+	MariaDBRepository = "mariadb"
+
+	// Default tag of MariaDB.
+	MariaDBDefaultTag = "10.6"
+
+	// Docker repository of Percona server.
+	PerconaRepository = "percona/percona-server"
+
+	// Default tag of Percona server.
+	PerconaDefaultTag = "8.0"
+
+	// Docker repository of TiDB.
+	TiDBRepository = "pingcap/tidb"
+
+	// Default tag of TiDB.
+	TiDBDefaultTag = "v5.0.1"
+)
+
+// flavorSpec describes how to run a flavor's docker image.
+type flavorSpec struct {
+	// TCP port in the container.
+	port string
+
+	// Prefix of environment variables for the docker entrypoint, "" if not supported.
+	envPrefix string
+
+	// Directory in the container of init SQL files, "" if not supported.
+	initDir string
+
+	// Data directory in the container.
+	dataDir string
+
+	// Directory in the container for extra option files, "" if not supported.
+	confDir string
+
+	// Whether mysqld command line options (and binlog) are supported.
+	serverArgs bool
+}
+
+func (flavor Flavor) spec() (*flavorSpec, error) {
+	switch flavor {
+	case MySQL:
+		return &flavorSpec{
+			port:       "3306",
+			envPrefix:  "MYSQL_",
+			initDir:    "/docker-entrypoint-initdb.d",
+			dataDir:    "/var/lib/mysql",
+			confDir:    "/etc/mysql/conf.d",
+			serverArgs: true,
+		}, nil
+	case MariaDB:
+		return &flavorSpec{
+			port:       "3306",
+			envPrefix:  "MARIADB_",
+			initDir:    "/docker-entrypoint-initdb.d",
+			dataDir:    "/var/lib/mysql",
+			confDir:    "/etc/mysql/conf.d",
+			serverArgs: true,
+		}, nil
+	case Percona:
+		return &flavorSpec{
+			port:       "3306",
+			envPrefix:  "MYSQL_",
+			initDir:    "/docker-entrypoint-initdb.d",
+			dataDir:    "/var/lib/mysql",
+			confDir:    "/etc/my.cnf.d",
+			serverArgs: true,
+		}, nil
+	case TiDB:
+		return &flavorSpec{
+			port:    "4000",
+			dataDir: "/tmp/tidb",
+		}, nil
+	default:
+		return nil, fmt.Errorf("tstmysql: unknown flavor %+q", flavor)
+	}
+}
+
+// repository returns the default docker repository and tag of the flavor.
+func (flavor Flavor) repository() (string, string) {
+	switch flavor {
+	case MariaDB:
+		return MariaDBRepository, MariaDBDefaultTag
+	case Percona:
+		return PerconaRepository, PerconaDefaultTag
+	case TiDB:
+		return TiDBRepository, TiDBDefaultTag
+	default:
+		return Repository, DefaultTag
+	}
+}
+
+// checkFlavor returns an error if some options are not supported by the flavor.
+func (opts *Options) checkFlavor(spec *flavorSpec) error {
+	if !spec.serverArgs && (len(opts.ServerVariables) != 0 || opts.Binlog) {
+		return fmt.Errorf("tstmysql: ServerVariables/Binlog are not supported by flavor %s", opts.Flavor)
+	}
+	if !spec.serverArgs && opts.TLS {
+		return fmt.Errorf("tstmysql: TLS is not supported by flavor %s", opts.Flavor)
+	}
+	if opts.LoadTimeZones && opts.Flavor == TiDB {
+		return fmt.Errorf("tstmysql: LoadTimeZones is not supported by flavor %s", opts.Flavor)
+	}
+	if opts.Binlog && opts.Flavor == MariaDB {
+		return fmt.Errorf("tstmysql: Binlog is not supported by flavor %s", opts.Flavor)
+	}
+	if spec.confDir == "" && (opts.MyCnf != "" || opts.MyCnfFS != nil) {
+		return fmt.Errorf("tstmysql: MyCnf/MyCnfFS are not supported by flavor %s", opts.Flavor)
+	}
+	return nil
+}
+
+// bootstrapTiDB creates DBName and User, runs HostInitSQLPath scripts and then sets the root password
+// for a fresh TiDB server.
+func (res *Resource) bootstrapTiDB(ctx context.Context) error {
+	opts := &res.Options
+	db, err := sql.Open("mysql", res.localDSN("root", "", ""))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stmts := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteIdent(opts.DBName)),
+	}
+	if opts.User != "" {
+		stmts = append(stmts,
+			fmt.Sprintf("CREATE USER IF NOT EXISTS %s IDENTIFIED BY %s", quoteAccount(opts.User, "%"),
+				quoteString(opts.Password)),
+			fmt.Sprintf("GRANT ALL ON %s.* TO %s", quoteIdent(opts.DBName), quoteAccount(opts.User, "%")),
+		)
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if opts.HostInitSQLPath != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdent(opts.DBName)); err != nil {
+			return err
+		}
+		scripts, err := InitSQLDir(opts.HostInitSQLPath).Scripts()
+		if err != nil {
+			return err
+		}
+		for _, script := range scripts {
+			if err := execStatements(ctx, conn, script.Name, SplitStatements(script.Content)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER USER 'root'@'%%' IDENTIFIED BY %s", quoteString(opts.RootPassword)))
+	return err
+}
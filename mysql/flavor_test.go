@@ -0,0 +1,75 @@
+package tstmysql
+
+import (
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFlavor(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Flavor("oracle").spec()
+	assert.Error(err)
+
+	for _, c := range []struct {
+		opts Options
+		ok   bool
+	}{
+		{Options{Flavor: MySQL, Binlog: true, MyCnf: "[mysqld]"}, true},
+		{Options{Flavor: Percona, Binlog: true}, true},
+		{Options{Flavor: MariaDB, ServerVariables: map[string]string{"sql_mode": ""}}, true},
+		{Options{Flavor: MariaDB, Binlog: true}, false},
+		{Options{Flavor: TiDB}, true},
+		{Options{Flavor: TiDB, ServerVariables: map[string]string{"sql_mode": ""}}, false},
+		{Options{Flavor: TiDB, MyCnf: "[mysqld]"}, false},
+	} {
+		spec, err := c.opts.Flavor.spec()
+		if !assert.NoError(err) {
+			continue
+		}
+		err = c.opts.checkFlavor(spec)
+		if c.ok {
+			assert.NoError(err, "%+v", c.opts)
+		} else {
+			assert.Error(err, "%+v", c.opts)
+		}
+	}
+}
+
+func TestFlavors(t *testing.T) {
+	for _, flavor := range []Flavor{MySQL, MariaDB, Percona, TiDB} {
+		flavor := flavor
+		t.Run(string(flavor), func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := Run(&Options{
+				Flavor:            flavor,
+				RandomCredentials: true,
+				InitSQL: []InitSQL{InitSQLString("schema.sql", `
+					CREATE TABLE xxx (
+						id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+					);
+				`)},
+			})
+			if !assert.NoError(err) {
+				return
+			}
+			defer res.Close()
+
+			db, err := res.UserClient()
+			if !assert.NoError(err) {
+				return
+			}
+			defer db.Close()
+
+			var version string
+			assert.NoError(db.QueryRow("SELECT VERSION()").Scan(&version))
+			log.Printf("%s version: %s\n", flavor, version)
+
+			_, err = db.Exec("INSERT INTO xxx VALUES ()")
+			assert.NoError(err)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Script is a named SQL script.
+type Script struct {
+	// Name of the script, e.g. file name. Used in error reporting.
+	Name string
+
+	// Content of the script.
+	Content string
+}
+
+// InitSQL is a source of SQL scripts, see Options.InitSQL.
+type InitSQL interface {
+	// Scripts returns the scripts in execution order.
+	Scripts() ([]Script, error)
+}
+
+// InitSQLError is returned when executing an init SQL statement failed.
+type InitSQLError struct {
+	// Name of the script.
+	Script string
+
+	// The failed statement.
+	Statement Statement
+
+	// The original error.
+	Err error
+}
+
+type initSQLString Script
+
+type initSQLReader struct {
+	name string
+	r    io.Reader
+	once sync.Once
+	data string
+	err  error
+}
+
+type initSQLFS struct {
+	fsys    fs.FS
+	pattern string
+}
+
+// InitSQLString returns an InitSQL from a string.
+func InitSQLString(name, content string) InitSQL {
+	return &initSQLString{
+		Name:    name,
+		Content: content,
+	}
+}
+
+// InitSQLReader returns an InitSQL from a reader. The reader is read only once and the content is cached,
+// so that the returned InitSQL can be used multiple times.
+func InitSQLReader(name string, r io.Reader) InitSQL {
+	return &initSQLReader{
+		name: name,
+		r:    r,
+	}
+}
+
+// InitSQLFS returns an InitSQL from files matching pattern (see fs.Glob) in fsys, e.g. an embed.FS.
+// Files are executed in lexical order of their names.
+func InitSQLFS(fsys fs.FS, pattern string) InitSQL {
+	return &initSQLFS{
+		fsys:    fsys,
+		pattern: pattern,
+	}
+}
+
+// InitSQLDir returns an InitSQL from "*.sql" files in a host directory.
+func InitSQLDir(dir string) InitSQL {
+	return InitSQLFS(os.DirFS(dir), "*.sql")
+}
+
+// Scripts implements InitSQL.
+func (s *initSQLString) Scripts() ([]Script, error) {
+	return []Script{Script(*s)}, nil
+}
+
+// Scripts implements InitSQL.
+func (s *initSQLReader) Scripts() ([]Script, error) {
+	s.once.Do(func() {
+		var data []byte
+		data, s.err = ioutil.ReadAll(s.r)
+		s.data = string(data)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []Script{{Name: s.name, Content: s.data}}, nil
+}
+
+// Scripts implements InitSQL.
+func (s *initSQLFS) Scripts() ([]Script, error) {
+	// NOTE: fs.Glob returns names in lexical order.
+	names, err := fs.Glob(s.fsys, s.pattern)
+	if err != nil {
+		return nil, err
+	}
+	ret := []Script{}
+	for _, name := range names {
+		data, err := fs.ReadFile(s.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Script{Name: name, Content: string(data)})
+	}
+	return ret, nil
+}
+
+// Error implements error interface.
+func (e *InitSQLError) Error() string {
+	return fmt.Sprintf("tstmysql: init sql %s:%d: %s\n%s", e.Script, e.Statement.Line, e.Err, e.Statement.Text)
+}
+
+// Unwrap returns the original error.
+func (e *InitSQLError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScripts executes scripts from sources in order on db. All statements are executed in the same
+// connection, so session variables take effect for subsequent statements. It returns *InitSQLError
+// if any statement failed.
+func ExecScripts(ctx context.Context, db *sql.DB, sources ...InitSQL) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, source := range sources {
+		scripts, err := source.Scripts()
+		if err != nil {
+			return err
+		}
+		for _, script := range scripts {
+			if err := execStatements(ctx, conn, script.Name, SplitStatements(script.Content)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func execStatements(ctx context.Context, conn *sql.Conn, name string, stmts []Statement) error {
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt.Text); err != nil {
+			return &InitSQLError{
+				Script:    name,
+				Statement: stmt,
+				Err:       err,
+			}
+		}
+	}
+	return nil
+}
+
+// hasExistingData returns true if dir is not empty.
+func hasExistingData(dir string) (bool, error) {
+	if dir == "" {
+		return false, nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return len(names) > 0, nil
+}
@@ -0,0 +1,74 @@
+package tstmysql
+
+import (
+	"embed"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/initsql/*.sql
+var testInitSQLFS embed.FS
+
+func TestInitSQL(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{
+			InitSQLFS(testInitSQLFS, "testdata/initsql/*.sql"),
+			InitSQLString("03_string.sql", "CALL add_xxx('cat');"),
+			InitSQLReader("04_reader.sql", strings.NewReader("CALL add_xxx('dog');")),
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	log.Printf("MySQL server is up, DSN: %+q.\n", res.DSN())
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	names := []string{}
+	{
+		rows, err := db.Query("SELECT name FROM xxx ORDER BY id")
+		if !assert.NoError(err) {
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			assert.NoError(rows.Scan(&name))
+			names = append(names, name)
+		}
+		assert.NoError(rows.Err())
+	}
+	assert.Equal([]string{"ada", "bob", "cat", "dog"}, names)
+}
+
+func TestInitSQLError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Run(&Options{
+		InitSQL: []InitSQL{
+			InitSQLString("bad.sql", "SELECT 1;\n\nSELECT * FROM not_exists;"),
+		},
+	})
+	log.Printf("Error: %s\n", err)
+
+	initErr := &InitSQLError{}
+	if assert.True(errors.As(err, &initErr)) {
+		assert.Equal("bad.sql", initErr.Script)
+		assert.Equal(Statement{"SELECT * FROM not_exists", 3}, initErr.Statement)
+
+		mysqlErr := &mysql.MySQLError{}
+		assert.True(errors.As(err, &mysqlErr))
+	}
+}
@@ -0,0 +1,278 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// MySQL error number of deadlocks.
+	ErrDeadlock = 1213
+
+	// MySQL error number of lock wait timeouts.
+	ErrLockWaitTimeout = 1205
+
+	// MySQL error number of "Unknown thread id".
+	errNoSuchThread = 1094
+
+	// MySQL error number of "Query execution was interrupted".
+	errQueryInterrupted = 1317
+)
+
+// Lock is a lock held by a dedicated session, see Resource.HoldRowLock/HoldTableLock/HoldMetadataLock.
+type Lock struct {
+	// Connection id of the session.
+	ConnectionID uint64
+
+	db      *sql.DB
+	conn    *sql.Conn
+	release string
+	once    sync.Once
+	err     error
+}
+
+// IsDeadlock returns true if err is (or wraps) a MySQL deadlock error (1213).
+func IsDeadlock(err error) bool {
+	return isMySQLError(err, ErrDeadlock)
+}
+
+// IsLockWaitTimeout returns true if err is (or wraps) a MySQL lock wait timeout error (1205).
+func IsLockWaitTimeout(err error) bool {
+	return isMySQLError(err, ErrLockWaitTimeout)
+}
+
+func isMySQLError(err error, number uint16) bool {
+	var e *mysql.MySQLError
+	return errors.As(err, &e) && e.Number == number
+}
+
+// SetLockWaitTimeout sets innodb_lock_wait_timeout (in seconds) of the session.
+func SetLockWaitTimeout(ctx context.Context, conn *sql.Conn, seconds int) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION innodb_lock_wait_timeout=%d", seconds))
+	return err
+}
+
+// WithLockWaitTimeout returns dsn with innodb_lock_wait_timeout (in seconds) set for all its sessions.
+func WithLockWaitTimeout(dsn string, seconds int) (string, error) {
+	return withSessionVariable(dsn, "innodb_lock_wait_timeout", strconv.Itoa(seconds))
+}
+
+// withSessionVariable returns dsn with the session variable set (by the driver) when connecting.
+func withSessionVariable(dsn, name, value string) (string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params[name] = value
+	return cfg.FormatDSN(), nil
+}
+
+// session opens a dedicated session (as root, in DBName).
+func (res *Resource) session(ctx context.Context) (*sql.DB, *sql.Conn, uint64, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, 0, err
+	}
+	var id uint64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, 0, err
+	}
+	return db, conn, id, nil
+}
+
+// holdLock runs stmts in a new session and keeps it until released or t finished.
+func (res *Resource) holdLock(t testing.TB, release string, stmts []string, args []interface{}) *Lock {
+	t.Helper()
+	ctx := context.Background()
+
+	db, conn, id, err := res.session(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Lock{
+		ConnectionID: id,
+		db:           db,
+		conn:         conn,
+		release:      release,
+	}
+	t.Cleanup(func() { l.Release() })
+
+	for i, stmt := range stmts {
+		var stmtArgs []interface{}
+		if i == len(stmts)-1 {
+			stmtArgs = args
+		}
+		if _, err := conn.ExecContext(ctx, stmt, stmtArgs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+// HoldRowLock locks rows (FOR UPDATE) of table in DBName matching where (with args) in a transaction of
+// a dedicated session, until released or t finished.
+func (res *Resource) HoldRowLock(t testing.TB, table, where string, args ...interface{}) *Lock {
+	t.Helper()
+	return res.holdLock(t, "ROLLBACK", []string{
+		"START TRANSACTION",
+		fmt.Sprintf("SELECT * FROM %s WHERE %s FOR UPDATE", quoteIdent(table), where),
+	}, args)
+}
+
+// HoldTableLock locks the table in DBName (LOCK TABLES ... WRITE, or READ if write is false) in a dedicated
+// session, until released or t finished.
+func (res *Resource) HoldTableLock(t testing.TB, table string, write bool) *Lock {
+	t.Helper()
+	mode := "READ"
+	if write {
+		mode = "WRITE"
+	}
+	return res.holdLock(t, "UNLOCK TABLES", []string{
+		fmt.Sprintf("LOCK TABLES %s %s", quoteIdent(table), mode),
+	}, nil)
+}
+
+// HoldMetadataLock holds a shared metadata lock on the table in DBName by an open transaction which has read it
+// in a dedicated session, until released or t finished. DDL on the table (e.g. ALTER TABLE) waits for it.
+func (res *Resource) HoldMetadataLock(t testing.TB, table string) *Lock {
+	t.Helper()
+	return res.holdLock(t, "ROLLBACK", []string{
+		"START TRANSACTION",
+		fmt.Sprintf("SELECT * FROM %s LIMIT 0", quoteIdent(table)),
+	}, nil)
+}
+
+// Exec executes a statement in the session holding the lock.
+func (l *Lock) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return l.conn.ExecContext(ctx, query, args...)
+}
+
+// Release releases the lock and closes the session. It's safe to call multiple times.
+func (l *Lock) Release() error {
+	l.once.Do(func() {
+		_, l.err = l.conn.ExecContext(context.Background(), l.release)
+		l.conn.Close()
+		l.db.Close()
+	})
+	return l.err
+}
+
+// Deadlock deterministically produces a deadlock between two sessions: session A locks rows of table (in DBName)
+// matching whereA, session B locks rows matching whereB, then A waits for B's rows and B requests A's rows.
+// The rows should exist and not overlap. It returns the deadlock error received by the victim session.
+func (res *Resource) Deadlock(ctx context.Context, table, whereA, whereB string) (*mysql.MySQLError, error) {
+	lockStmt := func(where string) string {
+		return fmt.Sprintf("SELECT * FROM %s WHERE %s FOR UPDATE", quoteIdent(table), where)
+	}
+
+	dbA, connA, idA, err := res.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbA.Close()
+	defer connA.Close()
+	dbB, connB, _, err := res.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbB.Close()
+	defer connB.Close()
+
+	for _, step := range []struct {
+		conn *sql.Conn
+		stmt string
+	}{
+		{connA, "START TRANSACTION"},
+		{connA, lockStmt(whereA)},
+		{connB, "START TRANSACTION"},
+		{connB, lockStmt(whereB)},
+	} {
+		if _, err := step.conn.ExecContext(ctx, step.stmt); err != nil {
+			return nil, err
+		}
+	}
+	defer connA.ExecContext(ctx, "ROLLBACK")
+	defer connB.ExecContext(ctx, "ROLLBACK")
+
+	// A waits for B.
+	errA := make(chan error, 1)
+	go func() {
+		_, err := connA.ExecContext(ctx, lockStmt(whereB))
+		errA <- err
+	}()
+	if err := res.waitLockWait(ctx, idA, errA); err != nil {
+		return nil, err
+	}
+
+	// B requests A's rows.
+	_, errB := connB.ExecContext(ctx, lockStmt(whereA))
+	var e *mysql.MySQLError
+	if IsDeadlock(errB) {
+		// A got the rows after B rolled back.
+		<-errA
+		errors.As(errB, &e)
+		return e, nil
+	}
+	if errB != nil {
+		return nil, errB
+	}
+	if err := <-errA; IsDeadlock(err) {
+		errors.As(err, &e)
+		return e, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("tstmysql: no deadlock detected")
+}
+
+// waitLockWait waits until the transaction of the session is waiting for a lock. It fails if the statement of
+// the session finishes (reported to errc) before that.
+func (res *Resource) waitLockWait(ctx context.Context, connectionID uint64, errc <-chan error) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var n int
+		if err := db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM information_schema.INNODB_TRX
+			WHERE trx_mysql_thread_id=? AND trx_state='LOCK WAIT'`, connectionID).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("tstmysql: whereA/whereB do not conflict")
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDeadlock(t *testing.T) {
+	assert := assert.New(t)
+
+	deadlock := &mysql.MySQLError{Number: ErrDeadlock}
+	timeout := &mysql.MySQLError{Number: ErrLockWaitTimeout}
+	assert.True(IsDeadlock(deadlock))
+	assert.True(IsDeadlock(fmt.Errorf("wrapped: %w", deadlock)))
+	assert.False(IsDeadlock(timeout))
+	assert.False(IsDeadlock(nil))
+	assert.True(IsLockWaitTimeout(timeout))
+	assert.False(IsLockWaitTimeout(deadlock))
+}
+
+func TestWithLockWaitTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dsn, err := WithLockWaitTimeout("root:123456@tcp(localhost:3306)/tst?parseTime=true", 1)
+	assert.NoError(err)
+	cfg, err := mysql.ParseDSN(dsn)
+	assert.NoError(err)
+	assert.Equal("1", cfg.Params["innodb_lock_wait_timeout"])
+	assert.True(cfg.ParseTime)
+}
+
+func TestLocks(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+			);
+			INSERT INTO xxx VALUES (1), (2);
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	dsn, err := WithLockWaitTimeout(res.DSN(), 1)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Deadlock.
+	e, err := res.Deadlock(ctx, "xxx", "id=1", "id=2")
+	if assert.NoError(err) {
+		assert.True(IsDeadlock(e))
+	}
+
+	// No conflict: session A does not wait.
+	_, err = res.Deadlock(ctx, "xxx", "id=1", "id=3")
+	assert.EqualError(err, "tstmysql: whereA/whereB do not conflict")
+
+	// Row lock.
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(SetLockWaitTimeout(ctx, conn, 1))
+
+	lock := res.HoldRowLock(t, "xxx", "id=?", 1)
+	_, err = conn.ExecContext(ctx, "UPDATE xxx SET id=3 WHERE id=1")
+	assert.True(IsLockWaitTimeout(err))
+	_, err = conn.ExecContext(ctx, "UPDATE xxx SET id=4 WHERE id=2")
+	assert.NoError(err)
+	assert.NoError(lock.Release())
+	_, err = conn.ExecContext(ctx, "UPDATE xxx SET id=3 WHERE id=1")
+	assert.NoError(err)
+
+	// Table lock: other sessions' writes wait, lock_wait_timeout applies to table locks.
+	_, err = conn.ExecContext(ctx, "SET SESSION lock_wait_timeout=1")
+	assert.NoError(err)
+	lock = res.HoldTableLock(t, "xxx", false)
+	_, err = conn.ExecContext(ctx, "INSERT INTO xxx VALUES (5)")
+	assert.True(IsLockWaitTimeout(err))
+	assert.NoError(lock.Release())
+
+	// Metadata lock.
+	lock = res.HoldMetadataLock(t, "xxx")
+	_, err = conn.ExecContext(ctx, "ALTER TABLE xxx ADD COLUMN name TEXT")
+	assert.True(IsLockWaitTimeout(err))
+	assert.NoError(lock.Release())
+
+	// Timeout by DSN.
+	res.HoldRowLock(t, "xxx", "id=?", 3)
+	timeoutDB, err := sql.Open("mysql", dsn)
+	if assert.NoError(err) {
+		defer timeoutDB.Close()
+		_, err = timeoutDB.Exec("DELETE FROM xxx WHERE id=3")
+		assert.True(IsLockWaitTimeout(err))
+	}
+}
@@ -0,0 +1,314 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Default table name to track applied migrations.
+	DefaultMigrationsTable = "schema_migrations"
+)
+
+var (
+	// golang-migrate style: "{version}_{title}.up.sql" and "{version}_{title}.down.sql".
+	migrateFileRegexp = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+	// goose style: "{version}_{title}.sql" with "-- +goose Up" and "-- +goose Down" annotations.
+	gooseFileRegexp = regexp.MustCompile(`^(\d+)_(.*)\.sql$`)
+)
+
+// Migration is a versioned schema migration.
+type Migration struct {
+	// Version of the migration, parsed from the numeric prefix of file name.
+	Version int64
+
+	// Title of the migration, parsed from file name.
+	Title string
+
+	// File name(s) of the migration, used in error reporting.
+	UpFile   string
+	DownFile string
+
+	// Statements to migrate up/down.
+	Up   []Statement
+	Down []Statement
+}
+
+// LoadMigrations loads migrations from the root directory of fsys, sorted by version.
+// Both golang-migrate style ("1_init.up.sql"/"1_init.down.sql") and goose style ("1_init.sql" with
+// "-- +goose Up"/"-- +goose Down" annotations) files are supported. Other files are ignored.
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := map[int64]*Migration{}
+	getMigration := func(version, title string) (*Migration, error) {
+		v, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		m := migrations[v]
+		if m == nil {
+			m = &Migration{Version: v, Title: title}
+			migrations[v] = m
+		}
+		return m, nil
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+
+		if match := migrateFileRegexp.FindStringSubmatch(name); match != nil {
+			m, err := getMigration(match[1], match[2])
+			if err != nil {
+				return nil, err
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			if match[3] == "up" {
+				if m.UpFile != "" {
+					return nil, fmt.Errorf("tstmysql: duplicate up migration %d: %s and %s", m.Version, m.UpFile, name)
+				}
+				m.UpFile, m.Up = name, SplitStatements(string(data))
+			} else {
+				if m.DownFile != "" {
+					return nil, fmt.Errorf("tstmysql: duplicate down migration %d: %s and %s", m.Version, m.DownFile, name)
+				}
+				m.DownFile, m.Down = name, SplitStatements(string(data))
+			}
+			continue
+		}
+
+		if match := gooseFileRegexp.FindStringSubmatch(name); match != nil {
+			m, err := getMigration(match[1], match[2])
+			if err != nil {
+				return nil, err
+			}
+			if m.UpFile != "" || m.DownFile != "" {
+				return nil, fmt.Errorf("tstmysql: duplicate migration %d: %s", m.Version, name)
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			m.UpFile, m.DownFile = name, name
+			m.Up, m.Down, err = parseGoose(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("tstmysql: migration %s: %s", name, err)
+			}
+		}
+	}
+
+	ret := make([]*Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.UpFile == "" {
+			return nil, fmt.Errorf("tstmysql: missing up migration %d", m.Version)
+		}
+		ret = append(ret, m)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, nil
+}
+
+// parseGoose parses a goose style migration file. Lines out of the section are blanked before splitting,
+// so that line numbers of statements are preserved. It returns an error if there is no Up section.
+func parseGoose(content string) (up, down []Statement, err error) {
+	const (
+		none = iota
+		inUp
+		inDown
+	)
+
+	lines := strings.Split(content, "\n")
+	upLines := make([]string, len(lines))
+	downLines := make([]string, len(lines))
+	section := none
+	hasUp := false
+	blockStart := -1 // Line index of "StatementBegin".
+	block := []string{}
+
+	for i, line := range lines {
+		annotation := strings.TrimSpace(line)
+		if strings.HasPrefix(annotation, "-- +goose ") {
+			switch strings.TrimSpace(strings.TrimPrefix(annotation, "-- +goose ")) {
+			case "Up":
+				section = inUp
+				hasUp = true
+			case "Down":
+				section = inDown
+			case "StatementBegin":
+				blockStart = i
+				block = block[:0]
+			case "StatementEnd":
+				if blockStart >= 0 {
+					stmt := Statement{
+						Text: strings.TrimSuffix(strings.TrimSpace(strings.Join(block, "\n")), ";"),
+						Line: blockStart + 2,
+					}
+					if section == inUp {
+						up = append(up, stmt)
+					} else if section == inDown {
+						down = append(down, stmt)
+					}
+				}
+				blockStart = -1
+			}
+			continue
+		}
+		if blockStart >= 0 {
+			block = append(block, line)
+			continue
+		}
+		switch section {
+		case inUp:
+			upLines[i] = line
+		case inDown:
+			downLines[i] = line
+		}
+	}
+
+	merge := func(blocks []Statement, lines []string) []Statement {
+		ret := append(SplitStatements(strings.Join(lines, "\n")), blocks...)
+		sort.SliceStable(ret, func(i, j int) bool { return ret[i].Line < ret[j].Line })
+		return ret
+	}
+	if !hasUp {
+		return nil, nil, fmt.Errorf("no \"-- +goose Up\" section")
+	}
+	return merge(up, upLines), merge(down, downLines), nil
+}
+
+// Migrate applies all up migrations in Options.Migrations.
+func (res *Resource) Migrate(ctx context.Context) error {
+	if len(res.migrations) == 0 {
+		return nil
+	}
+	return res.MigrateTo(ctx, res.migrations[len(res.migrations)-1].Version)
+}
+
+// MigrateTo migrates the database (DBName) to the given version: applies missing up migrations with version
+// <= version in ascending order, then applies down migrations of applied ones with version > version in
+// descending order. Use 0 to migrate down all.
+func (res *Resource) MigrateTo(ctx context.Context, version int64) error {
+	return res.withMigrations(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for _, m := range res.migrations {
+			if m.Version <= version && !applied[m.Version] {
+				if err := res.applyMigration(ctx, conn, m, true); err != nil {
+					return err
+				}
+			}
+		}
+		for i := len(res.migrations) - 1; i >= 0; i-- {
+			m := res.migrations[i]
+			if m.Version > version && applied[m.Version] {
+				if err := res.applyMigration(ctx, conn, m, false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown applies the down migration of the latest applied migration.
+func (res *Resource) MigrateDown(ctx context.Context) error {
+	return res.withMigrations(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for i := len(res.migrations) - 1; i >= 0; i-- {
+			m := res.migrations[i]
+			if applied[m.Version] {
+				return res.applyMigration(ctx, conn, m, false)
+			}
+		}
+		return fmt.Errorf("tstmysql: no applied migration")
+	})
+}
+
+// MigrationVersion returns the version of the latest applied migration, 0 if none.
+func (res *Resource) MigrationVersion(ctx context.Context) (int64, error) {
+	ret := int64(0)
+	err := res.withMigrations(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for version := range applied {
+			if version > ret {
+				ret = version
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+func (res *Resource) withMigrations(ctx context.Context, f func(conn *sql.Conn, applied map[int64]bool) error) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	table := quoteIdent(res.Options.MigrationsTable)
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT NOT NULL PRIMARY KEY,
+		applied_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+	)`, table)); err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return f(conn, applied)
+}
+
+func (res *Resource) applyMigration(ctx context.Context, conn *sql.Conn, m *Migration, up bool) error {
+	table := quoteIdent(res.Options.MigrationsTable)
+	if up {
+		if err := execStatements(ctx, conn, m.UpFile, m.Up); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table), m.Version)
+		return err
+	}
+
+	if m.DownFile == "" {
+		return fmt.Errorf("tstmysql: missing down migration %d", m.Version)
+	}
+	if err := execStatements(ctx, conn, m.DownFile, m.Down); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version=?", table), m.Version)
+	return err
+}
@@ -0,0 +1,100 @@
+package tstmysql
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := LoadMigrations(os.DirFS("testdata/migrations"))
+	if !assert.NoError(err) || !assert.Len(migrations, 2) {
+		return
+	}
+
+	m1 := migrations[0]
+	assert.Equal(int64(1), m1.Version)
+	assert.Equal("users", m1.Title)
+	assert.Equal("1_users.up.sql", m1.UpFile)
+	assert.Equal("1_users.down.sql", m1.DownFile)
+	assert.Len(m1.Up, 1)
+	assert.Equal([]Statement{{"DROP TABLE users", 1}}, m1.Down)
+
+	m2 := migrations[1]
+	assert.Equal(int64(2), m2.Version)
+	assert.Equal("2_posts.sql", m2.UpFile)
+	assert.Equal("2_posts.sql", m2.DownFile)
+	if assert.Len(m2.Up, 2) {
+		assert.Equal(2, m2.Up[0].Line)
+		assert.Equal(9, m2.Up[1].Line)
+		assert.Equal("CREATE PROCEDURE count_posts()\nBEGIN\n\tSELECT COUNT(*) FROM posts;\nEND", m2.Up[1].Text)
+	}
+	assert.Equal([]Statement{{"DROP PROCEDURE count_posts", 16}, {"DROP TABLE posts", 17}}, m2.Down)
+
+	// Errors.
+	_, err = LoadMigrations(fstest.MapFS{
+		"1_a.down.sql": &fstest.MapFile{},
+	})
+	assert.Error(err)
+	_, err = LoadMigrations(fstest.MapFS{
+		"1_a.up.sql": &fstest.MapFile{},
+		"1_b.sql":    &fstest.MapFile{},
+	})
+	assert.Error(err)
+	_, err = LoadMigrations(fstest.MapFS{
+		"1_a.sql": &fstest.MapFile{Data: []byte("CREATE TABLE a (id INT);\n")},
+	})
+	assert.Error(err)
+}
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		Migrations: os.DirFS("testdata/migrations"),
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	log.Printf("MySQL server is up, DSN: %+q.\n", res.DSN())
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	tables := func() []string {
+		tables, err := listTables(ctx, db, res.Options.DBName)
+		assert.NoError(err)
+		return tables
+	}
+	version := func() int64 {
+		version, err := res.MigrationVersion(ctx)
+		assert.NoError(err)
+		return version
+	}
+
+	assert.Equal(int64(2), version())
+	assert.Equal([]string{"posts", DefaultMigrationsTable, "users"}, tables())
+
+	assert.NoError(res.MigrateDown(ctx))
+	assert.Equal(int64(1), version())
+	assert.Equal([]string{DefaultMigrationsTable, "users"}, tables())
+
+	assert.NoError(res.MigrateTo(ctx, 0))
+	assert.Equal(int64(0), version())
+	assert.Equal([]string{DefaultMigrationsTable}, tables())
+	assert.Error(res.MigrateDown(ctx))
+
+	assert.NoError(res.Migrate(ctx))
+	assert.Equal(int64(2), version())
+}
@@ -1,10 +1,19 @@
 package tstmysql
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/ory/dockertest/v3"
@@ -26,6 +35,15 @@ var (
 	// Default root password.
 	DefaultRootPassword = "123456"
 
+	// Default (non-root) user name when RandomCredentials is true.
+	DefaultUser = "tst"
+
+	// Default password of the (non-root) user.
+	DefaultPassword = "123456"
+
+	// Length of random generated passwords.
+	RandomPasswordLength = 16
+
 	// Default container expire time.
 	DefaultExpire uint = 120
 )
@@ -33,6 +51,9 @@ var (
 var (
 	// Default options.
 	defaultOptions = &Options{}
+
+	// How long execContainerContext keeps trying to kill the command after ctx is done.
+	killTimeout = 10 * time.Second
 )
 
 var (
@@ -48,19 +69,67 @@ type Resource struct {
 
 	// Actual options.
 	Options
+
+	tracker *tstsvc.Tracker
+
+	pool *dockertest.Pool
+
+	flavor *flavorSpec
+
+	// Docker volumes removed when the resource closed.
+	volumes []string
+
+	certs   *Certs
+	tlsName string
+
+	migrations []*Migration
+
+	tempDirs []string
+
+	templateOnce sync.Once
+	templateErr  error
+
+	captureMu sync.Mutex
+	captures  int
+	// Global log_output and general_log before capturing started.
+	captureRestore string
 }
 
 // Options is options to run a MySQL test server.
 type Options struct {
-	// Tag of the repository. Default: DefaultTag.
+	// The server implementation. Default: MySQL.
+	Flavor Flavor
+
+	// Tag of the repository. Default: DefaultTag, or the default tag of Flavor (e.g. MariaDBDefaultTag).
 	Tag string
 
 	// The database created when MySQL server starts. Default: DefaultDBName.
 	DBName string
 
-	// The root password. Default: DefaultRootPassword.
+	// The root password. Default: DefaultRootPassword, or a random one if RandomCredentials is true.
 	RootPassword string
 
+	// If specified, a (non-root) user will be created with all privileges on DBName.
+	// Default: "", or DefaultUser if RandomCredentials is true.
+	User string
+
+	// The password of User. Default: DefaultPassword, or a random one if RandomCredentials is true.
+	Password string
+
+	// Additional (non-root) users with their grants, created (as root) after InitSQL and Migrations so that
+	// grants can refer to tables. See Resource.DSNFor/ClientFor. Default: nil.
+	Users []User
+
+	// If true, generate random passwords per Resource instead of using default ones. Default: false.
+	RandomCredentials bool
+
+	// If true, the data directory initialized with the options (entrypoint init, HostInitSQLPath, InitSQL,
+	// Migrations, Users ...) is cached as a snapshot in SnapshotDir, keyed by a hash of them. Servers are started
+	// from a copy of the snapshot (as HostDataPath), skipping the initialization. The first run creates the
+	// snapshot with an extra server. Can't be used with HostDataPath or RandomCredentials. Default: false.
+	// NOTE: Remove SnapshotDir to clear cached snapshots.
+	Snapshot bool
+
 	// If specified, MySQL data will be mount to this host directory. Default: "".
 	// NOTE: The directory must be either contain an existing MySQL database or completely empty.
 	HostDataPath string
@@ -69,7 +138,74 @@ type Options struct {
 	// NOTE: These files will not be loaded if HostDataPath is specified and contains an existing database.
 	HostInitSQLPath string
 
-	// If specified, the port 3306/tcp will be mapped to it. Default: random port.
+	// If specified, SQL scripts from these sources (see InitSQLString/InitSQLReader/InitSQLFS) will be executed
+	// in order (as root, in DBName) after the MySQL server is ready (i.e. after HostInitSQLPath loaded).
+	// The first failed statement stops the execution and an *InitSQLError is returned. Default: nil.
+	// NOTE: These scripts will not be executed if HostDataPath is specified and contains an existing database.
+	InitSQL []InitSQL
+
+	// If specified, migrations in the root directory of it (see LoadMigrations) will be applied (as root, in DBName)
+	// after InitSQL, see also Resource.MigrateTo/MigrateDown. Use os.DirFS for host directories. Default: nil.
+	// NOTE: Unlike InitSQL, migrations not applied yet are always applied even if HostDataPath contains an existing database.
+	Migrations fs.FS
+
+	// The table to track applied migrations. Default: DefaultMigrationsTable.
+	MigrationsTable string
+
+	// Tables not truncated by Resource.Reset. Default: nil.
+	ResetExclude []string
+
+	// Server system variables passed to mysqld as command line options, e.g. "sql_mode", "character_set_server",
+	// "default_time_zone", "max_connections". Default: nil.
+	ServerVariables map[string]string
+
+	// If true, load time zone tables (by mysql_tzinfo_to_sql in the container) at startup, so that named time zones
+	// work, e.g. in CONVERT_TZ. Not supported by TiDB, which has builtin time zones. Default: false.
+	// NOTE: The tables will not be loaded if HostDataPath is specified and contains an existing database.
+	LoadTimeZones bool
+
+	// If specified, the global time_zone is set to it at startup, e.g. "+08:00", or a named time zone
+	// like "Asia/Shanghai" which needs LoadTimeZones. Default: "".
+	TimeZone string
+
+	// If not zero, sessions from DSNs and clients returned by the Resource (DSN, UserDSN, DSNFor, NetworkDSN,
+	// DatabaseDSN, Client, TxDB ...) set session variable "timestamp" to it, so that NOW(), CURRENT_TIMESTAMP()
+	// etc. return it (frozen). Internal connections (migrations, fixtures ...) run on real time. It must be
+	// between 1970-01-01 00:00:01 and 2038-01-19 03:14:07 UTC. It can be changed (e.g. res.Options.FakeTime = t)
+	// for new sessions. See also WithFakeTime.
+	// NOTE: Faking the server clock (e.g. by libfaketime) is not implemented. Default: zero.
+	FakeTime time.Time
+
+	// If specified, it's mounted as an option file into /etc/mysql/conf.d. Default: "".
+	MyCnf string
+
+	// If specified, "*.cnf" files in the root directory of it are mounted into /etc/mysql/conf.d. Default: nil.
+	MyCnfFS fs.FS
+
+	// If true, enable the binary log for CDC tools or replication: ROW format, full row image and GTID mode.
+	// Variables in ServerVariables take precedence. A replication user (ReplUser) is also created. Default: false.
+	Binlog bool
+
+	// server_id of the server when Binlog is true. Default: DefaultServerID.
+	ServerID uint32
+
+	// The replication user when Binlog is true. Default: DefaultReplUser.
+	ReplUser string
+
+	// The password of ReplUser. Default: DefaultReplPassword, or a random one if RandomCredentials is true.
+	ReplPassword string
+
+	// If true, generate a throwaway CA, server and client certificates, start the server with them and
+	// require_secure_transport, and register a TLS config (see Resource.TLSConfigName) used by DSNs to connect
+	// from the host. Not supported by TiDB. Default: false.
+	// NOTE: NetworkDSN does not contain the TLS config, clients in other containers need Resource.Certs.
+	TLS bool
+
+	// If true, User and Users are required to connect with a client certificate signed by the generated CA
+	// (REQUIRE X509). TLS must be true. Default: false.
+	RequireX509 bool
+
+	// If specified, the server port (3306/tcp, or 4000/tcp for TiDB) will be mapped to it. Default: random port.
 	HostPort uint16
 
 	// Expire time (in seconds) of the container. Default: DefaultExpire.
@@ -91,6 +227,12 @@ func Run(opts *Options) (*Resource, error) {
 // RunFromPool runs a test MySQL server. If pool is nil, tstsvc.DefaultPool() will be used.
 // If opts is nil, the default options will be used.
 func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
+	return runFromPool(pool, opts, "")
+}
+
+// runFromPool runs a test MySQL server. If dataVolume is not empty, the docker volume is mounted as the data
+// directory, which contains an existing database.
+func runFromPool(pool *dockertest.Pool, opts *Options, dataVolume string) (*Resource, error) {
 	// Handle nil case.
 	if pool == nil {
 		pool = tstsvc.DefaultPool()
@@ -102,18 +244,70 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	// Collect options.
 	res := &Resource{
 		Options: *opts,
+		pool:    pool,
 	}
 	opts = &res.Options
 
+	if opts.Flavor == "" {
+		opts.Flavor = MySQL
+	}
+	spec, err := opts.Flavor.spec()
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkFlavor(spec); err != nil {
+		return nil, err
+	}
+	res.flavor = spec
+	repository, defaultTag := opts.Flavor.repository()
 	if opts.Tag == "" {
-		opts.Tag = DefaultTag
+		opts.Tag = defaultTag
 	}
 	if opts.DBName == "" {
 		opts.DBName = DefaultDBName
 	}
+	if opts.RandomCredentials {
+		if opts.RootPassword == "" {
+			opts.RootPassword = tstsvc.RandomString(RandomPasswordLength)
+		}
+		if opts.User == "" {
+			opts.User = DefaultUser
+		}
+		if opts.Password == "" {
+			opts.Password = tstsvc.RandomString(RandomPasswordLength)
+		}
+	}
 	if opts.RootPassword == "" {
 		opts.RootPassword = DefaultRootPassword
 	}
+	if opts.User != "" && opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if opts.Binlog {
+		if opts.ServerID == 0 {
+			opts.ServerID = DefaultServerID
+		}
+		if opts.ReplUser == "" {
+			opts.ReplUser = DefaultReplUser
+		}
+		if opts.ReplPassword == "" {
+			if opts.RandomCredentials {
+				opts.ReplPassword = tstsvc.RandomString(RandomPasswordLength)
+			} else {
+				opts.ReplPassword = DefaultReplPassword
+			}
+		}
+	}
+	if err := checkFakeTime(opts.FakeTime); err != nil {
+		return nil, err
+	}
+	if opts.RequireX509 && (!opts.TLS || (opts.User == "" && len(opts.Users) == 0)) {
+		return nil, fmt.Errorf("tstmysql: RequireX509 needs TLS and User or Users")
+	}
+	opts.resolveUsers()
+	if opts.MigrationsTable == "" {
+		opts.MigrationsTable = DefaultMigrationsTable
+	}
 	if opts.HostPort == 0 {
 		opts.HostPort = tstsvc.FreePort()
 	}
@@ -121,27 +315,90 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		opts.Expire = DefaultExpire
 	}
 
+	// Load migrations.
+	if opts.Migrations != nil {
+		res.migrations, err = LoadMigrations(opts.Migrations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Start from a data directory snapshot.
+	if opts.Snapshot {
+		snapshotRepository := opts.BaseRunOptions.Repository
+		if snapshotRepository == "" {
+			snapshotRepository = repository
+		}
+		if err := res.useSnapshot(pool, snapshotRepository); err != nil {
+			res.removeTempDirs()
+			return nil, err
+		}
+	}
+
+	// Check existing data before the container writes to it.
+	existingData, err := hasExistingData(opts.HostDataPath)
+	if err != nil {
+		return nil, err
+	}
+	if dataVolume != "" {
+		existingData = true
+	}
+
 	// Copy and collect RunOptions.
 	runOpts := opts.BaseRunOptions
 	runOpts.Env = append([]string(nil), runOpts.Env...)
+	runOpts.Cmd = append([]string(nil), runOpts.Cmd...)
 	runOpts.Mounts = append([]string(nil), runOpts.Mounts...)
 
 	if runOpts.Repository == "" {
-		runOpts.Repository = Repository
+		runOpts.Repository = repository
 	}
 	runOpts.Tag = opts.Tag
-	runOpts.Env = append(runOpts.Env,
-		fmt.Sprintf("MYSQL_DATABASE=%s", opts.DBName),
-		fmt.Sprintf("MYSQL_ROOT_PASSWORD=%s", opts.RootPassword),
-	)
-	if opts.HostInitSQLPath != "" {
-		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:/docker-entrypoint-initdb.d", opts.HostInitSQLPath))
+	if prefix := spec.envPrefix; prefix != "" {
+		runOpts.Env = append(runOpts.Env,
+			fmt.Sprintf("%sDATABASE=%s", prefix, opts.DBName),
+			fmt.Sprintf("%sROOT_PASSWORD=%s", prefix, opts.RootPassword),
+		)
+		if opts.User != "" {
+			runOpts.Env = append(runOpts.Env,
+				fmt.Sprintf("%sUSER=%s", prefix, opts.User),
+				fmt.Sprintf("%sPASSWORD=%s", prefix, opts.Password),
+			)
+		}
+	}
+	if opts.HostInitSQLPath != "" && spec.initDir != "" {
+		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:%s", opts.HostInitSQLPath, spec.initDir))
 	}
 	if opts.HostDataPath != "" {
-		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:/var/lib/mysql", opts.HostDataPath))
+		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:%s", opts.HostDataPath, spec.dataDir))
+	} else if dataVolume != "" {
+		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:%s", dataVolume, spec.dataDir))
+		res.volumes = append(res.volumes, dataVolume)
+	}
+	if opts.Binlog {
+		runOpts.Cmd = append(runOpts.Cmd, serverVariableArgs(binlogVariables(opts.ServerVariables, opts.ServerID))...)
+	} else {
+		runOpts.Cmd = append(runOpts.Cmd, serverVariableArgs(opts.ServerVariables)...)
+	}
+	{
+		mounts, err := res.myCnfMounts()
+		if err != nil {
+			res.removeTempDirs()
+			return nil, err
+		}
+		runOpts.Mounts = append(runOpts.Mounts, mounts...)
+	}
+	if opts.TLS {
+		mounts, args, err := res.setupTLS()
+		if err != nil {
+			res.removeTempDirs()
+			return nil, err
+		}
+		runOpts.Mounts = append(runOpts.Mounts, mounts...)
+		runOpts.Cmd = append(runOpts.Cmd, args...)
 	}
 	runOpts.PortBindings = map[dc.Port][]dc.PortBinding{
-		"3306/tcp": []dc.PortBinding{
+		dc.Port(spec.port + "/tcp"): []dc.PortBinding{
 			dc.PortBinding{
 				HostIP:   "localhost",
 				HostPort: fmt.Sprintf("%d", opts.HostPort),
@@ -149,11 +406,26 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		},
 	}
 
-	var err error
+	// Track timings.
+	res.tracker = tstsvc.Track(string(opts.Flavor), runOpts.Repository, runOpts.Tag)
+	if err := res.tracker.Pull(pool, runOpts.Repository, runOpts.Tag, runOpts.Auth); err != nil {
+		res.removeTempDirs()
+		return nil, err
+	}
+
 	res.Resource, err = pool.RunWithOptions(&runOpts)
 	if err != nil {
+		res.removeTempDirs()
 		return nil, err
 	}
+	res.tracker.Created(res.Resource)
+
+	if opts.TLS {
+		if err := res.registerTLS(); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
 
 	// Set expire of the container.
 	res.Resource.Expire(opts.Expire)
@@ -162,9 +434,14 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	mysql.SetLogger(noopLogger)
 	defer mysql.SetLogger(errLogger)
 
-	// Wait.
+	// Wait. A fresh TiDB server has no root password.
+	waitDSN := res.rootDSN()
+	bootstrapTiDB := opts.Flavor == TiDB && !existingData
+	if bootstrapTiDB {
+		waitDSN = res.localDSN("root", "", "")
+	}
 	if err := pool.Retry(func() error {
-		db, err := res.Client()
+		db, err := sql.Open("mysql", waitDSN)
 		if err != nil {
 			return err
 		}
@@ -175,20 +452,343 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		return nil, err
 	}
 
+	// Init.
+	if bootstrapTiDB {
+		if err := res.bootstrapTiDB(context.Background()); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	if opts.LoadTimeZones && !existingData {
+		if err := res.loadTimeZones(); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	if opts.TimeZone != "" {
+		if err := res.setTimeZone(context.Background()); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	if opts.Binlog {
+		if err := res.createReplUser(context.Background()); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	if !existingData && len(opts.InitSQL) != 0 {
+		if err := res.execInitSQL(); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	if err := res.Migrate(context.Background()); err != nil {
+		res.Close()
+		return nil, err
+	}
+	if err := res.createUsers(context.Background()); err != nil {
+		res.Close()
+		return nil, err
+	}
+	if opts.RequireX509 {
+		if err := res.requireX509(context.Background()); err != nil {
+			res.Close()
+			return nil, err
+		}
+	}
+	res.tracker.Ready(pool, res.Resource)
+
 	return res, nil
 }
 
-// DSN returns the data source name of the test MySQL server.
+// Close removes the container, temporary files, volumes and the registered TLS config.
+func (res *Resource) Close() error {
+	defer res.deregisterTLS()
+	res.cleanDataDir()
+	err := res.tracker.Close(res.Resource.Close)
+	res.removeVolumes()
+	if e := res.removeTempDirs(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// cleanDataDir empties a temporary data directory (e.g. a copy of Snapshot) from inside the container, since
+// files created by mysqld are owned by its user and may not be removable by the host user.
+func (res *Resource) cleanDataDir() {
+	for _, dir := range res.tempDirs {
+		if dir == res.Options.HostDataPath {
+			res.Resource.Exec([]string{"find", res.flavor.dataDir, "-mindepth", "1", "-delete"}, dockertest.ExecOptions{})
+			return
+		}
+	}
+}
+
+// removeVolumes removes volumes (passed from an upgraded Resource) not removed along with the container.
+func (res *Resource) removeVolumes() {
+	for _, volume := range res.volumes {
+		res.pool.Client.RemoveVolume(volume)
+	}
+	res.volumes = nil
+}
+
+// tempDir creates a temporary directory which will be removed when the resource closed.
+func (res *Resource) tempDir() (string, error) {
+	dir, err := ioutil.TempDir("", "tstmysql")
+	if err != nil {
+		return "", err
+	}
+	res.tempDirs = append(res.tempDirs, dir)
+	return dir, nil
+}
+
+// removeTempDirs removes temporary directories, it returns the first error.
+func (res *Resource) removeTempDirs() error {
+	var ret error
+	for _, dir := range res.tempDirs {
+		if err := os.RemoveAll(dir); err != nil && ret == nil {
+			ret = fmt.Errorf("tstmysql: remove temporary directory: %s", err)
+		}
+	}
+	res.tempDirs = nil
+	return ret
+}
+
+// exec executes statements (as root) in the same connection.
+func (res *Resource) exec(ctx context.Context, stmts ...string) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execContainer executes cmd inside the container with MYSQL_PWD set to the root password. It returns an error
+// containing stderr if the exit code is not zero.
+func (res *Resource) execContainer(cmd []string, stdin io.Reader, stdout io.Writer) error {
+	stderr := &bytes.Buffer{}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	code, err := res.Resource.Exec(cmd, dockertest.ExecOptions{
+		Env:    []string{fmt.Sprintf("MYSQL_PWD=%s", res.Options.RootPassword)},
+		StdIn:  stdin,
+		StdOut: stdout,
+		StdErr: stderr,
+	})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("tstmysql: exec %+q exit code %d: %s", cmd, code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// execContainerContext is like execContainer, but the command is killed when ctx is done, in which case
+// ctx.Err() is returned after the command exits (or killTimeout elapsed). If the command has already
+// finished, its result is returned.
+func (res *Resource) execContainerContext(ctx context.Context, cmd []string, stdin io.Reader, stdout io.Writer) error {
+	if ctx.Done() == nil {
+		return res.execContainer(cmd, stdin, stdout)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Record pid of the command so that it can be killed by another exec.
+	pidFile := fmt.Sprintf("/tmp/tstmysql-%s.pid", tstsvc.RandomString(10))
+	wrapped := append([]string{"sh", "-c", fmt.Sprintf(`echo $$ >%s && exec "$@"`, pidFile), "sh"}, cmd...)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- res.execContainer(wrapped, stdin, stdout)
+	}()
+
+	done := func(err error) error {
+		res.execContainer([]string{"rm", "-f", pidFile}, nil, nil)
+		return err
+	}
+	select {
+	case err := <-errc:
+		return done(err)
+	case <-ctx.Done():
+	}
+	select {
+	case err := <-errc:
+		return done(err)
+	default:
+	}
+
+	kill := []string{"sh", "-c", fmt.Sprintf("kill $(cat %s)", pidFile)}
+	timeout := time.After(killTimeout)
+	for {
+		// The pid file may not be written yet.
+		res.execContainer(kill, nil, nil)
+		select {
+		case err := <-errc:
+			if err == nil {
+				// Finished before killed.
+				return done(nil)
+			}
+			return done(ctx.Err())
+		case <-timeout:
+			done(nil)
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (res *Resource) execInitSQL() error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return ExecScripts(context.Background(), db, res.Options.InitSQL...)
+}
+
+// DSN returns the data source name (as root) of the test MySQL server.
 func (res *Resource) DSN() string {
-	return fmt.Sprintf(
-		"root:%s@tcp(localhost:%d)/%s?parseTime=true",
-		res.Options.RootPassword,
-		res.Options.HostPort,
-		res.Options.DBName,
-	)
+	return res.withFakeTime(res.localConfig("root", res.Options.RootPassword, res.Options.DBName)).FormatDSN()
 }
 
-// Client returns a client to the test MySQL server.
+// Client returns a client (as root) to the test MySQL server.
 func (res *Resource) Client() (*sql.DB, error) {
 	return sql.Open("mysql", res.DSN())
 }
+
+// UserDSN returns the data source name (as User) of the test MySQL server.
+// It returns "" if User is not specified.
+func (res *Resource) UserDSN() string {
+	if res.Options.User == "" {
+		return ""
+	}
+	return res.withFakeTime(res.localConfig(res.Options.User, res.Options.Password, res.Options.DBName)).FormatDSN()
+}
+
+// UserClient returns a client (as User) to the test MySQL server.
+func (res *Resource) UserClient() (*sql.DB, error) {
+	if res.Options.User == "" {
+		return nil, fmt.Errorf("tstmysql: Options.User is not specified")
+	}
+	return sql.Open("mysql", res.UserDSN())
+}
+
+// NetworkDSN returns the data source name (as root) to connect to the test MySQL server from another
+// container in the same docker network.
+func (res *Resource) NetworkDSN() string {
+	cfg := res.config("root", res.Options.RootPassword, res.networkAddr(), res.Options.DBName)
+	return res.withFakeTime(cfg).FormatDSN()
+}
+
+func (res *Resource) localAddr() string {
+	return fmt.Sprintf("localhost:%d", res.Options.HostPort)
+}
+
+func (res *Resource) networkAddr() string {
+	return fmt.Sprintf("%s:%s", tstsvc.ContainerName(res.Resource), res.flavor.port)
+}
+
+func (res *Resource) config(user, password, addr, dbName string) *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = addr
+	cfg.DBName = dbName
+	cfg.ParseTime = true
+	return cfg
+}
+
+func (res *Resource) dsn(user, password, addr, dbName string) string {
+	return res.config(user, password, addr, dbName).FormatDSN()
+}
+
+// localConfig returns the config to connect from the host, with the registered TLS config if Options.TLS
+// is true.
+func (res *Resource) localConfig(user, password, dbName string) *mysql.Config {
+	cfg := res.config(user, password, res.localAddr(), dbName)
+	cfg.TLSConfig = res.tlsName
+	return cfg
+}
+
+// localDSN returns the data source name to connect from the host, see localConfig.
+func (res *Resource) localDSN(user, password, dbName string) string {
+	return res.localConfig(user, password, dbName).FormatDSN()
+}
+
+// rootDSN returns the data source name (as root, in DBName) for internal connections, which always run on
+// real time (Options.FakeTime is not applied).
+func (res *Resource) rootDSN() string {
+	return res.localDSN("root", res.Options.RootPassword, res.Options.DBName)
+}
+
+// rootClient returns a client for internal connections, see rootDSN.
+func (res *Resource) rootClient() (*sql.DB, error) {
+	return sql.Open("mysql", res.rootDSN())
+}
+
+// withFakeTime applies Options.FakeTime to cfg, which is returned to callers.
+func (res *Resource) withFakeTime(cfg *mysql.Config) *mysql.Config {
+	if res.Options.FakeTime.IsZero() {
+		return cfg
+	}
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["timestamp"] = fakeTimestamp(res.Options.FakeTime)
+	return cfg
+}
+
+// NetworkEnv implements tstsvc.NetworkEnver.
+func (res *Resource) NetworkEnv() map[string]string {
+	return map[string]string{
+		"MYSQL_DSN": res.NetworkDSN(),
+	}
+}
+
+// Export implements tstsvc.Exporter.
+func (res *Resource) Export() map[string]string {
+	return map[string]string{
+		"MYSQL_DSN": res.DSN(),
+	}
+}
+
+// Matrix runs f as a subtest against a test MySQL server for each tag. tags can be overrided by
+// environment variable TSTSVC_MYSQL_TAGS (comma separated) and DefaultTag is used if both are empty.
+// For other flavors, the environment variable is named after the flavor (e.g. TSTSVC_MARIADB_TAGS) and the
+// default tag is the flavor's.
+// opts is used as the base options of each server (with Tag replaced), nil for the default options.
+// If parallel is true, the subtests are run in parallel, in which case HostXXXPort in opts should be zero.
+func Matrix(t *testing.T, tags []string, parallel bool, opts *Options, f func(t *testing.T, res *Resource)) {
+	if opts == nil {
+		opts = defaultOptions
+	}
+	flavor := opts.Flavor
+	if flavor == "" {
+		flavor = MySQL
+	}
+	_, defaultTag := flavor.repository()
+	tstsvc.MatrixResources(t, string(flavor), tags, defaultTag, parallel, func(tag string) (io.Closer, error) {
+		o := *opts
+		o.Tag = tag
+		return Run(&o)
+	}, func(t *testing.T, res io.Closer) {
+		f(t, res.(*Resource))
+	})
+}
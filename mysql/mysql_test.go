@@ -131,3 +131,39 @@ func TestRun(t *testing.T) {
 		assert.Equal(int64(2), n.Int64)
 	}
 }
+
+func TestRandomCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{RandomCredentials: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	log.Printf("MySQL server is up, DSN: %+q, user DSN: %+q.\n", res.DSN(), res.UserDSN())
+
+	assert.NotEqual(DefaultRootPassword, res.Options.RootPassword)
+	assert.Equal(DefaultUser, res.Options.User)
+
+	db, err := res.UserClient()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	var user string
+	assert.NoError(db.QueryRow("SELECT CURRENT_USER()").Scan(&user))
+	assert.Equal(DefaultUser+"@%", user)
+}
+
+func TestMatrix(t *testing.T) {
+	Matrix(t, nil, false, nil, func(t *testing.T, res *Resource) {
+		db, err := res.Client()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer db.Close()
+		assert.NoError(t, db.Ping())
+		log.Printf("MySQL server %s is up, dsn: %+q.\n", res.Options.Tag, res.DSN())
+	})
+}
@@ -0,0 +1,161 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Process is an entry of the server's processlist.
+type Process struct {
+	// Connection id.
+	ID uint64
+
+	User    string
+	Host    string
+	DB      string
+	Command string
+
+	// Time in seconds the connection has been in its current state.
+	Time int64
+
+	State string
+
+	// The statement being executed, "" if none.
+	Info string
+}
+
+// ProcessFilter selects processlist entries.
+type ProcessFilter func(p *Process) bool
+
+// ProcessOfUser selects connections of the user.
+func ProcessOfUser(user string) ProcessFilter {
+	return func(p *Process) bool {
+		return p.User == user
+	}
+}
+
+// ProcessInDB selects connections whose current database is db.
+func ProcessInDB(db string) ProcessFilter {
+	return func(p *Process) bool {
+		return p.DB == db
+	}
+}
+
+// ProcessIdle selects idle connections (command "Sleep").
+func ProcessIdle() ProcessFilter {
+	return func(p *Process) bool {
+		return p.Command == "Sleep"
+	}
+}
+
+// ProcessRunning selects connections executing a statement.
+func ProcessRunning() ProcessFilter {
+	return func(p *Process) bool {
+		return p.Command == "Query" || p.Command == "Execute"
+	}
+}
+
+// Processlist returns client connections of the server matching all filters, excluding the one used by itself
+// and system threads (e.g. "event_scheduler").
+func (res *Resource) Processlist(ctx context.Context, filters ...ProcessFilter) ([]Process, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return processlist(ctx, db, filters)
+}
+
+func processlist(ctx context.Context, db *sql.DB, filters []ProcessFilter) ([]Process, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO FROM information_schema.PROCESSLIST
+		WHERE ID<>CONNECTION_ID() AND USER NOT IN ('event_scheduler', 'system user')
+		ORDER BY ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []Process{}
+	for rows.Next() {
+		var p Process
+		var dbName, state, info sql.NullString
+		if err := rows.Scan(&p.ID, &p.User, &p.Host, &dbName, &p.Command, &p.Time, &state, &info); err != nil {
+			return nil, err
+		}
+		p.DB, p.State, p.Info = dbName.String, state.String, info.String
+		if matchProcess(&p, filters) {
+			ret = append(ret, p)
+		}
+	}
+	return ret, rows.Err()
+}
+
+func notBinlogDump(p *Process) bool {
+	return !strings.HasPrefix(p.Command, "Binlog Dump")
+}
+
+func matchProcess(p *Process, filters []ProcessFilter) bool {
+	for _, filter := range filters {
+		if !filter(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// KillConnections kills client connections matching all filters (all client connections if no filter), see
+// Processlist. Replication connections (command "Binlog Dump" or "Binlog Dump GTID") are never killed.
+// Clients using the killed connections get errors like "invalid connection" or "MySQL server has gone away".
+// It returns the number of killed connections.
+func (res *Resource) KillConnections(ctx context.Context, filters ...ProcessFilter) (int, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	processes, err := processlist(ctx, db, append([]ProcessFilter{notBinlogDump}, filters...))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range processes {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("KILL CONNECTION %d", p.ID)); err != nil {
+			// The connection may be gone already.
+			if isMySQLError(err, errNoSuchThread) {
+				continue
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// KillQuery kills the statement being executed by the connection, leaving the connection intact. The client
+// gets "Query execution was interrupted" (1317).
+func (res *Resource) KillQuery(ctx context.Context, id uint64) error {
+	return res.exec(ctx, fmt.Sprintf("KILL QUERY %d", id))
+}
+
+// SetWaitTimeout sets the global wait_timeout (in seconds), so that new connections idle longer than it are
+// closed by the server. Existing connections are not affected, see also WithWaitTimeout.
+// NOTE: The setting lasts until the server restarts.
+func (res *Resource) SetWaitTimeout(ctx context.Context, seconds int) error {
+	return res.exec(ctx, fmt.Sprintf("SET GLOBAL wait_timeout=%d", seconds))
+}
+
+// WithWaitTimeout returns dsn with wait_timeout (in seconds) set for all its sessions.
+func WithWaitTimeout(dsn string, seconds int) (string, error) {
+	return withSessionVariable(dsn, "wait_timeout", strconv.Itoa(seconds))
+}
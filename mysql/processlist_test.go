@@ -0,0 +1,100 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Process{User: "tst", DB: "tst", Command: "Sleep"}
+	assert.True(matchProcess(p, nil))
+	assert.True(matchProcess(p, []ProcessFilter{ProcessOfUser("tst"), ProcessInDB("tst"), ProcessIdle()}))
+	assert.False(matchProcess(p, []ProcessFilter{ProcessOfUser("root")}))
+	assert.False(matchProcess(p, []ProcessFilter{ProcessRunning()}))
+	assert.True(notBinlogDump(p))
+	assert.False(notBinlogDump(&Process{Command: "Binlog Dump GTID"}))
+}
+
+func TestKillConnections(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		User: "tst",
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	db, err := res.UserClient()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(conn.PingContext(ctx))
+
+	processes, err := res.Processlist(ctx, ProcessOfUser("tst"))
+	assert.NoError(err)
+	assert.Len(processes, 1)
+
+	// Kill the connection.
+	n, err := res.KillConnections(ctx, ProcessOfUser("tst"))
+	assert.NoError(err)
+	assert.Equal(1, n)
+	_, err = conn.ExecContext(ctx, "SELECT 1")
+	assert.Error(err)
+
+	// The pool reconnects.
+	assert.NoError(db.PingContext(ctx))
+
+	// Kill a running query.
+	var id uint64
+	conn2, err := db.Conn(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn2.Close()
+	assert.NoError(conn2.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id))
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		assert.NoError(res.KillQuery(ctx, id))
+	}()
+	// NOTE: A query only invoking SLEEP returns 1 without error when interrupted.
+	var count int
+	err = conn2.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.TABLES WHERE SLEEP(10)=0").Scan(&count)
+	assert.True(isMySQLError(err, errQueryInterrupted), "%v", err)
+	assert.NoError(conn2.PingContext(ctx))
+
+	// Idle connections are closed by the server.
+	assert.NoError(res.SetWaitTimeout(ctx, 1))
+	dsn, err := WithWaitTimeout(res.UserDSN(), 1)
+	if !assert.NoError(err) {
+		return
+	}
+	db2, err := sql.Open("mysql", dsn)
+	if !assert.NoError(err) {
+		return
+	}
+	defer db2.Close()
+	conn3, err := db2.Conn(ctx)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn3.Close()
+	time.Sleep(2 * time.Second)
+	_, err = conn3.ExecContext(ctx, "SELECT 1")
+	assert.Error(err)
+}
@@ -0,0 +1,607 @@
+package tstmysql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL client/server protocol constants used by Proxy.
+const (
+	maxPacketSize = 1<<24 - 1
+
+	comQuit             = 0x01
+	comInitDB           = 0x02
+	comQuery            = 0x03
+	comStatistics       = 0x09
+	comDebug            = 0x0d
+	comPing             = 0x0e
+	comStmtPrepare      = 0x16
+	comStmtExecute      = 0x17
+	comStmtSendLongData = 0x18
+	comStmtClose        = 0x19
+	comStmtReset        = 0x1a
+	comSetOption        = 0x1b
+	comResetConnection  = 0x1f
+
+	packetOK        = 0x00
+	packetLocalFile = 0xfb
+	packetEOF       = 0xfe
+	packetErr       = 0xff
+
+	// Capabilities not supported by Proxy, they are removed from the handshake so that the client does not use
+	// them.
+	unsupportedCapabilities = 0x00000020 | // CLIENT_COMPRESS
+		0x00000800 | // CLIENT_SSL
+		0x01000000 | // CLIENT_DEPRECATE_EOF
+		0x02000000 | // CLIENT_OPTIONAL_RESULTSET_METADATA
+		0x08000000 // CLIENT_QUERY_ATTRIBUTES
+
+	serverMoreResultsExists = 0x0008
+)
+
+// ProxyStatement is a statement recorded by Proxy.
+type ProxyStatement struct {
+	// Connection (thread) id, the same as CONNECTION_ID() of the session.
+	ConnectionID uint64
+
+	// Command type: "Query" (COM_QUERY) or "Execute" (COM_STMT_EXECUTE).
+	Command string
+
+	// SQL text. For "Execute", it's the prepared statement (with placeholders).
+	SQL string
+
+	// Time when the command was sent to the server.
+	Start time.Time
+
+	// Duration until the last response packet was received from the server.
+	Duration time.Duration
+
+	// Number of rows in result sets.
+	Rows int
+
+	// Affected rows reported by OK packets.
+	AffectedRows uint64
+
+	// Error returned by the server (a *mysql.MySQLError), if any.
+	Err error
+}
+
+// Proxy is a MySQL protocol proxy in front of the test MySQL server which records statements and round trips of
+// clients connected through it, see Resource.Proxy.
+// NOTE: TLS, compression, LOCAL INFILE and cursors are not supported. Connections sending commands other than
+// statements, COM_PING, COM_INIT_DB etc. (e.g. COM_CHANGE_USER) are closed with the test marked as failed.
+type Proxy struct {
+	// If true, each recorded statement is logged by t.Logf. Set it before connecting.
+	Verbose bool
+
+	t        testing.TB
+	res      *Resource
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	conns      map[net.Conn]struct{}
+	statements []ProxyStatement
+	roundTrips int
+}
+
+// Proxy starts a recording proxy to the test MySQL server on a random local port. It's closed when the test
+// finished. Options.TLS is not supported.
+func (res *Resource) Proxy(t testing.TB) *Proxy {
+	t.Helper()
+	if res.Options.TLS {
+		t.Fatal("tstmysql: Proxy does not support TLS")
+	}
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{
+		t:        t,
+		res:      res,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	t.Cleanup(p.close)
+	return p
+}
+
+// Addr returns the address of the proxy.
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// DSN returns the data source name (as root) through the proxy.
+func (p *Proxy) DSN() string {
+	return p.DSNFor("root")
+}
+
+// DSNFor returns the data source name of a user (see Resource.DSNFor) through the proxy.
+// It returns "" if the user is not found.
+func (p *Proxy) DSNFor(name string) string {
+	dsn := p.res.DSNFor(name)
+	if dsn == "" {
+		return ""
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		panic(err)
+	}
+	cfg.Addr = p.Addr()
+	cfg.TLSConfig = ""
+	return cfg.FormatDSN()
+}
+
+// Statements returns statements recorded so far.
+func (p *Proxy) Statements() []ProxyStatement {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProxyStatement(nil), p.statements...)
+}
+
+// RoundTrips returns the number of commands (which have responses) sent to the server so far, including
+// commands other than statements, e.g. COM_STMT_PREPARE and COM_PING.
+func (p *Proxy) RoundTrips() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.roundTrips
+}
+
+// Reset discards statements and round trips recorded so far.
+func (p *Proxy) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statements = nil
+	p.roundTrips = 0
+}
+
+func (p *Proxy) close() {
+	p.listener.Close()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.handle(client)
+		}()
+	}
+}
+
+// track adds conn to the connection set, it returns false if the proxy is closed.
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.conns, conn)
+}
+
+func (p *Proxy) handle(client net.Conn) {
+	defer client.Close()
+	if !p.track(client) {
+		return
+	}
+	defer p.untrack(client)
+
+	server, err := net.Dial("tcp", p.res.localAddr())
+	if err != nil {
+		return
+	}
+	defer server.Close()
+	if !p.track(server) {
+		return
+	}
+	defer p.untrack(server)
+
+	sr := bufio.NewReader(server)
+	cr := bufio.NewReader(client)
+	connID, err := relayHandshake(sr, server, cr, client)
+	if err != nil {
+		return
+	}
+
+	stmts := make(map[uint32]string)
+	for {
+		cmd, err := readPacket(cr)
+		if err != nil {
+			return
+		}
+		if _, err := server.Write(cmd.raw); err != nil {
+			return
+		}
+		if len(cmd.payload) == 0 {
+			return
+		}
+		switch cmd.payload[0] {
+		case comQuit:
+			return
+		case comStmtClose:
+			if len(cmd.payload) >= 5 {
+				delete(stmts, binary.LittleEndian.Uint32(cmd.payload[1:]))
+			}
+			continue
+		case comStmtSendLongData:
+			continue
+		}
+		p.mu.Lock()
+		p.roundTrips++
+		p.mu.Unlock()
+
+		// Responses are buffered and sent to the client after the last packet received, so that durations do
+		// not include client side delays.
+		resp := &bytes.Buffer{}
+		start := time.Now()
+		switch cmd.payload[0] {
+		case comQuery, comStmtExecute:
+			stmt := ProxyStatement{
+				ConnectionID: connID,
+				Start:        start,
+			}
+			if cmd.payload[0] == comQuery {
+				stmt.Command = "Query"
+				stmt.SQL = string(cmd.payload[1:])
+			} else {
+				stmt.Command = "Execute"
+				if len(cmd.payload) >= 5 {
+					stmt.SQL = stmts[binary.LittleEndian.Uint32(cmd.payload[1:])]
+				}
+			}
+			err = relayResult(sr, resp, &stmt)
+			stmt.Duration = time.Since(start)
+			if err != nil {
+				return
+			}
+			p.record(&stmt)
+
+		case comStmtPrepare:
+			id, ok, err := relayPrepare(sr, resp)
+			if err != nil {
+				return
+			}
+			if ok {
+				stmts[id] = string(cmd.payload[1:])
+			}
+
+		case comInitDB, comStatistics, comDebug, comPing, comStmtReset, comSetOption, comResetConnection:
+			// A single response packet (OK/ERR, or a string for COM_STATISTICS).
+			pkt, err := readPacket(sr)
+			if err != nil {
+				return
+			}
+			resp.Write(pkt.raw)
+
+		default:
+			// Other commands (e.g. COM_FIELD_LIST, COM_CHANGE_USER, COM_BINLOG_DUMP) have responses the proxy
+			// can't follow.
+			p.t.Errorf("tstmysql: proxy: unsupported command 0x%02x, connection closed", cmd.payload[0])
+			return
+		}
+		if _, err := client.Write(resp.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) record(stmt *ProxyStatement) {
+	p.mu.Lock()
+	p.statements = append(p.statements, *stmt)
+	verbose := p.Verbose
+	p.mu.Unlock()
+	if verbose {
+		p.t.Logf("tstmysql: proxy: [%d] %s %+q (%s, rows=%d, affected=%d, err=%v)", stmt.ConnectionID,
+			stmt.Command, stmt.SQL, stmt.Duration, stmt.Rows, stmt.AffectedRows, stmt.Err)
+	}
+}
+
+// packet is a (logical) MySQL packet.
+type packet struct {
+	// Payload of the packet, joined if it's split into several physical packets.
+	payload []byte
+
+	// Raw bytes of the packet (with headers).
+	raw []byte
+}
+
+func readPacket(r *bufio.Reader) (*packet, error) {
+	pkt := &packet{}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		pkt.raw = append(append(pkt.raw, header...), body...)
+		pkt.payload = append(pkt.payload, body...)
+		if n < maxPacketSize {
+			return pkt, nil
+		}
+	}
+}
+
+// setPayload replaces the payload of a single physical packet.
+func (pkt *packet) setPayload(payload []byte) {
+	n := len(payload)
+	pkt.payload = payload
+	pkt.raw = append([]byte{byte(n), byte(n >> 8), byte(n >> 16), pkt.raw[3]}, payload...)
+}
+
+// relayHandshake relays the connection phase with unsupported capabilities removed, it returns the connection
+// id of the session.
+func relayHandshake(sr *bufio.Reader, server io.Writer, cr *bufio.Reader, client io.Writer) (uint64, error) {
+	// Initial handshake packet (protocol version 10).
+	pkt, err := readPacket(sr)
+	if err != nil {
+		return 0, err
+	}
+	payload := pkt.payload
+	if len(payload) == 0 || payload[0] != 10 {
+		client.Write(pkt.raw)
+		return 0, fmt.Errorf("tstmysql: unexpected initial handshake packet")
+	}
+	i := 1
+	for i < len(payload) && payload[i] != 0 {
+		i++
+	}
+	// Server version, NUL, connection id (4), auth plugin data part 1 (8), filler (1), capabilities (lower 2),
+	// character set (1), status (2), capabilities (upper 2).
+	if i+1+4+8+1+2 > len(payload) {
+		return 0, fmt.Errorf("tstmysql: bad initial handshake packet")
+	}
+	connID := uint64(binary.LittleEndian.Uint32(payload[i+1:]))
+	i += 1 + 4 + 8 + 1
+	payload = append([]byte(nil), payload...)
+	binary.LittleEndian.PutUint16(payload[i:], binary.LittleEndian.Uint16(payload[i:])&^uint16(unsupportedCapabilities&0xffff))
+	if j := i + 2 + 1 + 2; j+2 <= len(payload) {
+		binary.LittleEndian.PutUint16(payload[j:], binary.LittleEndian.Uint16(payload[j:])&^uint16(unsupportedCapabilities>>16))
+	}
+	pkt.setPayload(payload)
+	if _, err := client.Write(pkt.raw); err != nil {
+		return 0, err
+	}
+
+	// Handshake response.
+	pkt, err = readPacket(cr)
+	if err != nil {
+		return 0, err
+	}
+	if len(pkt.payload) >= 4 {
+		payload := append([]byte(nil), pkt.payload...)
+		binary.LittleEndian.PutUint32(payload, binary.LittleEndian.Uint32(payload)&^uint32(unsupportedCapabilities))
+		pkt.setPayload(payload)
+	}
+	if _, err := server.Write(pkt.raw); err != nil {
+		return 0, err
+	}
+
+	// Authentication exchange until OK or ERR.
+	for {
+		pkt, err := readPacket(sr)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := client.Write(pkt.raw); err != nil {
+			return 0, err
+		}
+		if len(pkt.payload) == 0 {
+			return 0, fmt.Errorf("tstmysql: empty authentication packet")
+		}
+		switch pkt.payload[0] {
+		case packetOK:
+			return connID, nil
+		case packetErr:
+			return 0, parseErr(pkt.payload)
+		case 0x01:
+			// caching_sha2_password fast authentication success, the server sends OK next.
+			if len(pkt.payload) == 2 && pkt.payload[1] == 0x03 {
+				continue
+			}
+		}
+		// Auth switch request, more auth data (e.g. public key) etc., the client responds.
+		pkt, err = readPacket(cr)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := server.Write(pkt.raw); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// relayResult relays the response of COM_QUERY or COM_STMT_EXECUTE (text or binary result sets, OK or ERR),
+// with rows, affected rows and error recorded in stmt.
+func relayResult(sr *bufio.Reader, client io.Writer, stmt *ProxyStatement) error {
+	relay := func() (*packet, error) {
+		pkt, err := readPacket(sr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.Write(pkt.raw); err != nil {
+			return nil, err
+		}
+		if len(pkt.payload) == 0 {
+			return nil, fmt.Errorf("tstmysql: empty packet")
+		}
+		return pkt, nil
+	}
+
+	for {
+		pkt, err := relay()
+		if err != nil {
+			return err
+		}
+		switch pkt.payload[0] {
+		case packetOK:
+			affected, n := readLengthEncodedInt(pkt.payload[1:])
+			stmt.AffectedRows += affected
+			_, m := readLengthEncodedInt(pkt.payload[1+n:])
+			if status(pkt.payload[1+n+m:])&serverMoreResultsExists == 0 {
+				return nil
+			}
+			continue
+		case packetErr:
+			stmt.Err = parseErr(pkt.payload)
+			return nil
+		case packetLocalFile:
+			return fmt.Errorf("tstmysql: LOCAL INFILE is not supported")
+		}
+
+		// Result set: column count, column definitions, EOF, rows, EOF.
+		columns, _ := readLengthEncodedInt(pkt.payload)
+		for i := uint64(0); i <= columns; i++ {
+			if _, err := relay(); err != nil {
+				return err
+			}
+		}
+		for {
+			pkt, err := relay()
+			if err != nil {
+				return err
+			}
+			if pkt.payload[0] == packetErr {
+				stmt.Err = parseErr(pkt.payload)
+				return nil
+			}
+			if pkt.payload[0] == packetEOF && len(pkt.payload) < 9 {
+				// EOF: header, warnings (2), status (2).
+				if len(pkt.payload) < 5 {
+					return fmt.Errorf("tstmysql: bad EOF packet")
+				}
+				if status(pkt.payload[1+2:])&serverMoreResultsExists == 0 {
+					return nil
+				}
+				break
+			}
+			stmt.Rows++
+		}
+	}
+}
+
+// relayPrepare relays the response of COM_STMT_PREPARE, it returns the statement id and true if the statement
+// is prepared successfully.
+func relayPrepare(sr *bufio.Reader, client io.Writer) (uint32, bool, error) {
+	pkt, err := readPacket(sr)
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := client.Write(pkt.raw); err != nil {
+		return 0, false, err
+	}
+	// OK: status (1), statement id (4), columns (2), params (2), filler (1), warnings (2).
+	if len(pkt.payload) < 9 || pkt.payload[0] != packetOK {
+		return 0, false, nil
+	}
+	id := binary.LittleEndian.Uint32(pkt.payload[1:])
+	columns := int(binary.LittleEndian.Uint16(pkt.payload[5:]))
+	params := int(binary.LittleEndian.Uint16(pkt.payload[7:]))
+
+	// Parameter definitions and column definitions, each followed by EOF if not empty.
+	n := 0
+	if params > 0 {
+		n += params + 1
+	}
+	if columns > 0 {
+		n += columns + 1
+	}
+	for i := 0; i < n; i++ {
+		pkt, err := readPacket(sr)
+		if err != nil {
+			return 0, false, err
+		}
+		if _, err := client.Write(pkt.raw); err != nil {
+			return 0, false, err
+		}
+	}
+	return id, true, nil
+}
+
+// readLengthEncodedInt reads a length encoded integer, it returns the value and the number of bytes read.
+func readLengthEncodedInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	size := 0
+	switch b[0] {
+	case 0xfb:
+		return 0, 1
+	case 0xfc:
+		size = 2
+	case 0xfd:
+		size = 3
+	case 0xfe:
+		size = 8
+	default:
+		return uint64(b[0]), 1
+	}
+	if len(b) < 1+size {
+		return 0, len(b)
+	}
+	v := uint64(0)
+	for i := size; i > 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, 1 + size
+}
+
+// status returns the status flags at the beginning of b, 0 if b is too short.
+func status(b []byte) uint16 {
+	if len(b) < 2 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+// parseErr parses an ERR packet.
+func parseErr(payload []byte) error {
+	if len(payload) < 3 {
+		return errors.New("tstmysql: bad ERR packet")
+	}
+	e := &mysql.MySQLError{
+		Number: binary.LittleEndian.Uint16(payload[1:]),
+	}
+	msg := payload[3:]
+	// SQL state marker and SQL state (5).
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
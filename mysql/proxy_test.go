@@ -0,0 +1,184 @@
+package tstmysql
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// packets builds a stream of MySQL packets from payloads.
+func packets(payloads ...[]byte) []byte {
+	buf := []byte{}
+	for i, payload := range payloads {
+		n := len(payload)
+		buf = append(buf, byte(n), byte(n>>8), byte(n>>16), byte(i))
+		buf = append(buf, payload...)
+	}
+	return buf
+}
+
+func TestProxyRelayHandshake(t *testing.T) {
+	assert := assert.New(t)
+
+	handshake := []byte{10}
+	handshake = append(handshake, "8.0.25\x00"...)
+	handshake = append(handshake, 7, 0, 0, 0)
+	handshake = append(handshake, "12345678"...)
+	handshake = append(handshake, 0, 0xff, 0xff, 0x21, 0x02, 0x00, 0xff, 0xff)
+	handshake = append(handshake, "rest"...)
+	response := make([]byte, 32)
+	binary.LittleEndian.PutUint32(response, 0xffffffff)
+	server := bytes.NewBuffer(packets(handshake, []byte{packetOK, 0, 0, 2, 0, 0, 0}))
+	client := bytes.NewBuffer(packets(response))
+
+	toServer := &bytes.Buffer{}
+	toClient := &bytes.Buffer{}
+	connID, err := relayHandshake(bufio.NewReader(server), toServer, bufio.NewReader(client), toClient)
+	assert.NoError(err)
+	assert.Equal(uint64(7), connID)
+
+	// Unsupported capabilities are removed.
+	pkt, err := readPacket(bufio.NewReader(toClient))
+	assert.NoError(err)
+	caps := uint32(binary.LittleEndian.Uint16(pkt.payload[21:])) | uint32(binary.LittleEndian.Uint16(pkt.payload[26:]))<<16
+	assert.Equal(uint32(0xffffffff&^unsupportedCapabilities), caps)
+	assert.True(strings.HasSuffix(string(pkt.payload), "rest"))
+	pkt, err = readPacket(bufio.NewReader(toServer))
+	assert.NoError(err)
+	assert.Equal(uint32(0xffffffff&^unsupportedCapabilities), binary.LittleEndian.Uint32(pkt.payload))
+}
+
+func TestProxyRelayResult(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		// Result set.
+		stream := packets(
+			[]byte{1},
+			[]byte{3, 'd', 'e', 'f'},
+			[]byte{packetEOF, 0, 0, 0x02, 0},
+			[]byte{1, 'a'},
+			[]byte{1, 'b'},
+			[]byte{packetEOF, 0, 0, 0x02, 0},
+		)
+		out := &bytes.Buffer{}
+		stmt := &ProxyStatement{}
+		assert.NoError(relayResult(bufio.NewReader(bytes.NewReader(stream)), out, stmt))
+		assert.Equal(2, stmt.Rows)
+		assert.NoError(stmt.Err)
+		assert.Equal(stream, out.Bytes())
+	}
+
+	{
+		// Multiple results: OK and ERR.
+		stream := packets(
+			[]byte{packetOK, 5, 0, serverMoreResultsExists, 0, 0, 0},
+			append([]byte{packetErr, 0x7a, 0x04, '#', '4', '2', 'S', '0', '2'}, "Table 'tst.x' doesn't exist"...),
+		)
+		out := &bytes.Buffer{}
+		stmt := &ProxyStatement{}
+		assert.NoError(relayResult(bufio.NewReader(bytes.NewReader(stream)), out, stmt))
+		assert.Equal(uint64(5), stmt.AffectedRows)
+		var e *mysql.MySQLError
+		if assert.True(errors.As(stmt.Err, &e)) {
+			assert.Equal(uint16(1146), e.Number)
+			assert.Equal("Table 'tst.x' doesn't exist", e.Message)
+		}
+		assert.Equal(stream, out.Bytes())
+	}
+
+	{
+		// Malformed EOF.
+		stream := packets(
+			[]byte{1},
+			[]byte{3, 'd', 'e', 'f'},
+			[]byte{packetEOF, 0, 0, 0x02, 0},
+			[]byte{packetEOF, 0},
+		)
+		assert.Error(relayResult(bufio.NewReader(bytes.NewReader(stream)), &bytes.Buffer{}, &ProxyStatement{}))
+	}
+}
+
+func TestProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			INSERT INTO xxx (name) VALUES ('ada'), ('bob'), ('cat');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	p := res.Proxy(t)
+	p.Verbose = true
+	db, err := sql.Open("mysql", p.DSN())
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	assert.NoError(db.Ping())
+	p.Reset()
+
+	// Text protocol.
+	rows, err := db.Query("SELECT name FROM xxx ORDER BY id")
+	if !assert.NoError(err) {
+		return
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		assert.NoError(rows.Scan(&name))
+		names = append(names, name)
+	}
+	assert.NoError(rows.Err())
+	rows.Close()
+	assert.Equal([]string{"ada", "bob", "cat"}, names)
+
+	// Binary protocol: prepare, execute and close.
+	var name string
+	assert.NoError(db.QueryRow("SELECT name FROM xxx WHERE id=?", 2).Scan(&name))
+	assert.Equal("bob", name)
+
+	// Error.
+	_, err = db.Exec("UPDATE xxx SET name='x' WHERE nonexist=1")
+	assert.Error(err)
+
+	// Affected rows.
+	_, err = db.Exec("UPDATE xxx SET name='dan' WHERE id>1")
+	assert.NoError(err)
+
+	stmts := p.Statements()
+	if !assert.Len(stmts, 4) {
+		return
+	}
+	assert.Equal("Query", stmts[0].Command)
+	assert.Equal("SELECT name FROM xxx ORDER BY id", stmts[0].SQL)
+	assert.Equal(3, stmts[0].Rows)
+	assert.Equal("Execute", stmts[1].Command)
+	assert.Equal("SELECT name FROM xxx WHERE id=?", stmts[1].SQL)
+	assert.Equal(1, stmts[1].Rows)
+	assert.Error(stmts[2].Err)
+	assert.Equal(uint64(2), stmts[3].AffectedRows)
+	for _, stmt := range stmts {
+		assert.NotZero(stmt.ConnectionID)
+		assert.True(stmt.Duration > 0)
+	}
+
+	// Query, prepare, execute, query, query.
+	assert.Equal(5, p.RoundTrips())
+}
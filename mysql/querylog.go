@@ -0,0 +1,357 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Query is a statement captured from the general query log.
+type Query struct {
+	// Time of the statement.
+	Time time.Time
+
+	// User and host of the connection, e.g. "root[root] @  [172.17.0.1]".
+	UserHost string
+
+	// Connection (thread) id.
+	ConnectionID uint64
+
+	// Command type: "Query", "Prepare" or "Execute".
+	Command string
+
+	// SQL text. For "Execute", parameters are substituted.
+	SQL string
+
+	// Default database of the connection when the statement was executed, "" if unknown (e.g. the connection
+	// changed its database before capturing started and has closed since then).
+	DB string
+
+	// Tables accessed by full table scans, only set by QueryRecorder.FullScans.
+	FullScanTables []string
+}
+
+// QueryFilter selects captured queries.
+type QueryFilter func(q *Query) bool
+
+// QueryRecorder records statements executed by the test MySQL server, see Resource.CaptureQueries.
+type QueryRecorder struct {
+	t     testing.TB
+	db    *sql.DB
+	self  uint64
+	start time.Time
+}
+
+// CaptureQueries enables the general query log to table mysql.general_log and returns a recorder of statements
+// executed since then. "TABLE" is added to the global log_output, e.g. Variables{"log_output": "FILE"} becomes
+// "FILE,TABLE" while capturing. The general log is truncated when it's enabled or disabled, and when all
+// recorders' tests finished, the previous log_output and general_log are restored.
+// NOTE: The general log records statements of all connections, use filters to select queries of interest.
+func (res *Resource) CaptureQueries(t testing.TB) *QueryRecorder {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := res.rootClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Use a single connection so that its own statements can be excluded.
+	db.SetMaxOpenConns(1)
+	rec := &QueryRecorder{
+		t:  t,
+		db: db,
+	}
+
+	res.captureMu.Lock()
+	if res.captures == 0 {
+		var logOutput, generalLog string
+		if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.log_output, @@GLOBAL.general_log").Scan(&logOutput, &generalLog); err != nil {
+			res.captureMu.Unlock()
+			db.Close()
+			t.Fatal(err)
+		}
+		res.captureRestore = fmt.Sprintf("SET GLOBAL log_output=%s, GLOBAL general_log=%s",
+			quoteString(logOutput), generalLog)
+		for _, stmt := range []string{
+			"TRUNCATE TABLE mysql.general_log",
+			fmt.Sprintf("SET GLOBAL log_output=%s, GLOBAL general_log='ON'", quoteString(captureLogOutput(logOutput))),
+		} {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				res.captureMu.Unlock()
+				db.Close()
+				t.Fatal(err)
+			}
+		}
+	}
+	res.captures++
+	res.captureMu.Unlock()
+
+	t.Cleanup(func() {
+		defer db.Close()
+		res.captureMu.Lock()
+		defer res.captureMu.Unlock()
+		res.captures--
+		if res.captures == 0 {
+			for _, stmt := range []string{
+				res.captureRestore,
+				"TRUNCATE TABLE mysql.general_log",
+			} {
+				if _, err := db.ExecContext(ctx, stmt); err != nil {
+					t.Errorf("tstmysql: disable general log error: %s", err)
+					break
+				}
+			}
+		}
+	})
+
+	if err := db.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&rec.self); err != nil {
+		t.Fatal(err)
+	}
+	rec.Reset()
+	return rec
+}
+
+// captureLogOutput returns the log_output to capture queries: "TABLE" added to logOutput.
+func captureLogOutput(logOutput string) string {
+	outputs := []string{}
+	for _, output := range strings.Split(logOutput, ",") {
+		switch output = strings.ToUpper(strings.TrimSpace(output)); output {
+		case "", "NONE", "TABLE":
+			// NOTE: NONE overrides other outputs.
+		default:
+			outputs = append(outputs, output)
+		}
+	}
+	return strings.Join(append(outputs, "TABLE"), ",")
+}
+
+// Reset discards queries captured so far.
+func (rec *QueryRecorder) Reset() {
+	rec.t.Helper()
+	if err := rec.db.QueryRow("SELECT NOW(6)").Scan(&rec.start); err != nil {
+		rec.t.Fatal(err)
+	}
+}
+
+// Queries returns captured "Query", "Prepare" and "Execute" statements matching all filters in execution order.
+func (rec *QueryRecorder) Queries(filters ...QueryFilter) []Query {
+	rec.t.Helper()
+
+	rows, err := rec.db.Query(`
+		SELECT event_time, user_host, thread_id, command_type, argument FROM mysql.general_log
+		WHERE event_time>=? AND thread_id<>? AND command_type IN ('Connect', 'Init DB', 'Query', 'Prepare', 'Execute')
+		ORDER BY event_time`, rec.start, rec.self)
+	if err != nil {
+		rec.t.Fatal(err)
+	}
+	defer rows.Close()
+
+	// Track default databases of connections: by "Connect", "Init DB" and "USE" statements, or from the
+	// processlist if a connection has not changed its database since capturing started.
+	all := []Query{}
+	dbs := map[uint64]*string{}
+	changed := map[uint64]bool{}
+	for rows.Next() {
+		var q Query
+		var argument []byte
+		if err := rows.Scan(&q.Time, &q.UserHost, &q.ConnectionID, &q.Command, &argument); err != nil {
+			rec.t.Fatal(err)
+		}
+		q.SQL = string(argument)
+		if db, ok := changedDB(&q); ok {
+			dbs[q.ConnectionID] = &db
+			changed[q.ConnectionID] = true
+		}
+		if db := dbs[q.ConnectionID]; db != nil {
+			q.DB = *db
+		}
+		all = append(all, q)
+	}
+	if err := rows.Err(); err != nil {
+		rec.t.Fatal(err)
+	}
+	current, err := rec.processDBs()
+	if err != nil {
+		rec.t.Fatal(err)
+	}
+
+	ret := []Query{}
+	for _, q := range all {
+		if q.Command == "Connect" || q.Command == "Init DB" {
+			continue
+		}
+		if !changed[q.ConnectionID] {
+			q.DB = current[q.ConnectionID]
+		}
+		if matchQuery(&q, filters) {
+			ret = append(ret, q)
+		}
+	}
+	return ret
+}
+
+var (
+	connectDBRegexp = regexp.MustCompile(` on (\S*) using `)
+	useDBRegexp     = regexp.MustCompile("(?i)^\\s*USE\\s+(`(?:[^`]|``)+`|[^\\s;]+)\\s*;?\\s*$")
+)
+
+// changedDB returns the new default database if q changes it.
+func changedDB(q *Query) (string, bool) {
+	switch q.Command {
+	case "Connect":
+		// E.g. "root@172.17.0.1 on tst using TCP/IP".
+		if match := connectDBRegexp.FindStringSubmatch(q.SQL); match != nil {
+			return match[1], true
+		}
+		return "", true
+	case "Init DB":
+		return q.SQL, true
+	case "Query":
+		if match := useDBRegexp.FindStringSubmatch(q.SQL); match != nil {
+			db := match[1]
+			if strings.HasPrefix(db, "`") {
+				db = strings.Replace(db[1:len(db)-1], "``", "`", -1)
+			}
+			return db, true
+		}
+	}
+	return "", false
+}
+
+// processDBs returns current default databases of connections.
+func (rec *QueryRecorder) processDBs() (map[uint64]string, error) {
+	rows, err := rec.db.Query("SELECT ID, DB FROM information_schema.PROCESSLIST")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := map[uint64]string{}
+	for rows.Next() {
+		var id uint64
+		var db sql.NullString
+		if err := rows.Scan(&id, &db); err != nil {
+			return nil, err
+		}
+		ret[id] = db.String
+	}
+	return ret, rows.Err()
+}
+
+// FullScans EXPLAINs (in their default databases) captured "Query"/"Execute" SELECT, UPDATE and DELETE
+// statements matching all filters, and returns those using full table scans with Query.FullScanTables set.
+// Statements whose default databases are unknown are skipped.
+func (rec *QueryRecorder) FullScans(filters ...QueryFilter) []Query {
+	rec.t.Helper()
+
+	ret := []Query{}
+	filters = append([]QueryFilter{ByCommand("Query", "Execute"), explainable}, filters...)
+	for _, q := range rec.Queries(filters...) {
+		if q.DB == "" {
+			continue
+		}
+		tables, err := rec.explainFullScans(q.DB, q.SQL)
+		if err != nil {
+			rec.t.Fatalf("tstmysql: explain %+q error: %s", q.SQL, err)
+		}
+		if len(tables) != 0 {
+			q.FullScanTables = tables
+			ret = append(ret, q)
+		}
+	}
+	return ret
+}
+
+func (rec *QueryRecorder) explainFullScans(db, query string) ([]string, error) {
+	ctx := context.Background()
+	conn, err := rec.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "USE "+quoteIdent(db)); err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, "EXPLAIN "+query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	ret := []string{}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, column := range columns {
+			row[column] = string(values[i])
+		}
+		if row["type"] == "ALL" {
+			ret = append(ret, row["table"])
+		}
+	}
+	return ret, rows.Err()
+}
+
+func matchQuery(q *Query, filters []QueryFilter) bool {
+	for _, filter := range filters {
+		if !filter(q) {
+			return false
+		}
+	}
+	return true
+}
+
+var explainableRegexp = regexp.MustCompile(`(?i)^\s*(SELECT|UPDATE|DELETE)\b`)
+
+func explainable(q *Query) bool {
+	return explainableRegexp.MatchString(q.SQL)
+}
+
+// ByConnection selects queries of the connection (see CONNECTION_ID()).
+func ByConnection(id uint64) QueryFilter {
+	return func(q *Query) bool {
+		return q.ConnectionID == id
+	}
+}
+
+// ByUser selects queries of the user.
+func ByUser(user string) QueryFilter {
+	return func(q *Query) bool {
+		return strings.HasPrefix(q.UserHost, user+"[")
+	}
+}
+
+// ByCommand selects queries of the command types ("Query", "Prepare" or "Execute").
+func ByCommand(commands ...string) QueryFilter {
+	return func(q *Query) bool {
+		for _, command := range commands {
+			if q.Command == command {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Matching selects queries whose SQL matches the regular expression.
+func Matching(expr string) QueryFilter {
+	re := regexp.MustCompile(expr)
+	return func(q *Query) bool {
+		return re.MatchString(q.SQL)
+	}
+}
@@ -0,0 +1,125 @@
+package tstmysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &Query{
+		UserHost:     "tst[tst] @  [172.17.0.1]",
+		ConnectionID: 8,
+		Command:      "Execute",
+		SQL:          "SELECT * FROM users WHERE id=1",
+	}
+	assert.True(matchQuery(q, nil))
+	assert.True(matchQuery(q, []QueryFilter{ByUser("tst"), ByConnection(8), ByCommand("Query", "Execute")}))
+	assert.False(matchQuery(q, []QueryFilter{ByUser("root")}))
+	assert.False(matchQuery(q, []QueryFilter{ByConnection(9)}))
+	assert.False(matchQuery(q, []QueryFilter{ByCommand("Prepare")}))
+	assert.True(matchQuery(q, []QueryFilter{Matching(`(?i)from\s+users`), explainable}))
+	assert.False(explainable(&Query{SQL: "INSERT INTO users VALUES ()"}))
+	assert.True(explainable(&Query{SQL: "\n  delete FROM users"}))
+
+	// Default databases.
+	for _, c := range []struct {
+		q       Query
+		db      string
+		changed bool
+	}{
+		{Query{Command: "Connect", SQL: "tst@172.17.0.1 on app using TCP/IP"}, "app", true},
+		{Query{Command: "Connect", SQL: "tst@172.17.0.1 on  using TCP/IP"}, "", true},
+		{Query{Command: "Init DB", SQL: "app"}, "app", true},
+		{Query{Command: "Query", SQL: "use app;"}, "app", true},
+		{Query{Command: "Query", SQL: "USE `a``pp`"}, "a`pp", true},
+		{Query{Command: "Query", SQL: "SELECT 1"}, "", false},
+	} {
+		db, changed := changedDB(&c.q)
+		assert.Equal(c.db, db, c.q.SQL)
+		assert.Equal(c.changed, changed, c.q.SQL)
+	}
+
+	// TABLE is added to log_output.
+	assert.Equal("TABLE", captureLogOutput("NONE"))
+	assert.Equal("FILE,TABLE", captureLogOutput("FILE"))
+	assert.Equal("FILE,TABLE", captureLogOutput("TABLE,FILE"))
+}
+
+func TestCaptureQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		User: "tst",
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			INSERT INTO users (name) VALUES ('ada'), ('bob');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	db, err := res.UserClient()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	rec := res.CaptureQueries(t)
+	for _, id := range []int{1, 2} {
+		var name string
+		assert.NoError(db.QueryRow("SELECT name FROM users WHERE id=?", id).Scan(&name))
+	}
+	var n int
+	assert.NoError(db.QueryRow("SELECT COUNT(*) FROM users WHERE name='ada'").Scan(&n))
+
+	queries := rec.Queries(ByUser("tst"), Matching(`FROM users WHERE id=`))
+	assert.Len(queries, 2)
+	for _, q := range queries {
+		assert.Equal("Execute", q.Command)
+	}
+
+	fullScans := rec.FullScans(ByUser("tst"))
+	if assert.Len(fullScans, 1) {
+		assert.Equal("SELECT COUNT(*) FROM users WHERE name='ada'", fullScans[0].SQL)
+		assert.Equal([]string{"users"}, fullScans[0].FullScanTables)
+	}
+
+	rec.Reset()
+	assert.Len(rec.Queries(ByUser("tst")), 0)
+}
+
+func TestCaptureQueriesLogOutput(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		ServerVariables: map[string]string{"log_output": "FILE"},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	t.Run("capture", func(t *testing.T) {
+		res.CaptureQueries(t)
+		vars, err := res.Variables(ctx, "log_output", "general_log")
+		assert.NoError(err)
+		assert.Equal("FILE,TABLE", vars["log_output"])
+		assert.Equal("ON", vars["general_log"])
+	})
+
+	// Restored.
+	vars, err := res.Variables(ctx, "log_output", "general_log")
+	assert.NoError(err)
+	assert.Equal("FILE", vars["log_output"])
+	assert.Equal("OFF", vars["general_log"])
+}
@@ -0,0 +1,281 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+
+	"github.com/huangjunwen/tstsvc"
+)
+
+var (
+	// Default timeout of ReplicaSet.WaitCatchUp if the context has no deadline.
+	DefaultCatchUpTimeout = 60 * time.Second
+)
+
+// ReplicaSet is a test MySQL primary server with replicas using GTID based replication.
+type ReplicaSet struct {
+	// Docker network connecting the servers.
+	Network *dockertest.Network
+
+	// The primary server.
+	Primary *Resource
+
+	// The replica servers.
+	Replicas []*Resource
+
+	// The replication user and password (Options.ReplUser/ReplPassword of the primary) used by replicas to
+	// connect to the primary.
+	ReplUser     string
+	ReplPassword string
+}
+
+// RunReplicaSet runs a test MySQL primary server and n replicas replicating from it, all in a new docker network.
+// If pool is nil, tstsvc.DefaultPool() will be used. If opts is nil, the default options will be used.
+// Replicas are run with the same options except HostDataPath, HostPort (always random), InitSQL, Migrations and
+// Users, which are executed/created on the primary after replication started so that they are replicated.
+// All servers are run with Options.Binlog enabled and the primary's replication user, server_id of the primary
+// is 1 and of replica i is i+2. Replicas are read only.
+func RunReplicaSet(pool *dockertest.Pool, opts *Options, n int) (*ReplicaSet, error) {
+	// Handle nil case.
+	if pool == nil {
+		pool = tstsvc.DefaultPool()
+	}
+	if opts == nil {
+		opts = defaultOptions
+	}
+
+	rs := &ReplicaSet{}
+
+	var err error
+	rs.Network, err = pool.CreateNetwork("tstmysql-" + strings.ToLower(tstsvc.RandomString(10)))
+	if err != nil {
+		return nil, err
+	}
+
+	run := func(serverID uint32, primary bool) (*Resource, error) {
+		o := *opts
+		o.InitSQL = nil
+		o.Migrations = nil
+		o.Users = nil
+		if !primary {
+			o.HostDataPath = ""
+			o.HostPort = 0
+		}
+		o.Binlog = true
+		o.ServerID = serverID
+		if !primary {
+			o.ReplUser = rs.ReplUser
+			o.ReplPassword = rs.ReplPassword
+		}
+		o.BaseRunOptions.Networks = append(append([]*dockertest.Network(nil), o.BaseRunOptions.Networks...), rs.Network)
+		return RunFromPool(pool, &o)
+	}
+
+	// Run servers.
+	rs.Primary, err = run(1, true)
+	if err != nil {
+		rs.Close()
+		return nil, err
+	}
+	rs.ReplUser = rs.Primary.Options.ReplUser
+	rs.ReplPassword = rs.Primary.Options.ReplPassword
+	for i := 0; i < n; i++ {
+		replica, err := run(uint32(i+2), false)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		rs.Replicas = append(rs.Replicas, replica)
+	}
+
+	// Setup replication. Reset GTID history (transactions of the docker entrypoint) first so that all servers
+	// start from the same state.
+	ctx := context.Background()
+	for _, res := range rs.resources() {
+		if err := res.exec(ctx, "RESET MASTER"); err != nil {
+			rs.Close()
+			return nil, err
+		}
+	}
+	for i := range rs.Replicas {
+		if err := rs.Replicas[i].exec(ctx, rs.changeMasterStmts(rs.Primary)...); err != nil {
+			rs.Close()
+			return nil, err
+		}
+	}
+
+	// Init the primary.
+	primary := rs.Primary
+	primary.Options.InitSQL = opts.InitSQL
+	primary.Options.Migrations = opts.Migrations
+	if opts.Migrations != nil {
+		primary.migrations, err = LoadMigrations(opts.Migrations)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+	}
+	if len(opts.InitSQL) != 0 {
+		if err := primary.execInitSQL(); err != nil {
+			rs.Close()
+			return nil, err
+		}
+	}
+	if err := primary.Migrate(ctx); err != nil {
+		rs.Close()
+		return nil, err
+	}
+	primary.Options.Users = opts.Users
+	primary.Options.resolveUsers()
+	if err := primary.createUsers(ctx); err != nil {
+		rs.Close()
+		return nil, err
+	}
+	for _, replica := range rs.Replicas {
+		replica.Options.Users = primary.Options.Users
+	}
+	if err := rs.WaitCatchUp(ctx); err != nil {
+		rs.Close()
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// changeMasterStmts makes a server replicate from primary.
+func (rs *ReplicaSet) changeMasterStmts(primary *Resource) []string {
+	changeMaster := fmt.Sprintf(
+		"CHANGE MASTER TO MASTER_HOST=%s, MASTER_PORT=3306, MASTER_USER=%s, MASTER_PASSWORD=%s, MASTER_AUTO_POSITION=1",
+		quoteString(tstsvc.ContainerName(primary.Resource)), quoteString(rs.ReplUser),
+		quoteString(rs.ReplPassword),
+	)
+	if primary.Options.TLS {
+		changeMaster += ", MASTER_SSL=1"
+	}
+	return []string{
+		"SET GLOBAL read_only=ON",
+		changeMaster,
+		"START SLAVE",
+	}
+}
+
+func (rs *ReplicaSet) resources() []*Resource {
+	ret := []*Resource{}
+	if rs.Primary != nil {
+		ret = append(ret, rs.Primary)
+	}
+	return append(ret, rs.Replicas...)
+}
+
+// PrimaryDSN returns the data source name (as root) of the primary.
+func (rs *ReplicaSet) PrimaryDSN() string {
+	return rs.Primary.DSN()
+}
+
+// ReplicaDSNs returns the data source names (as root) of the replicas.
+func (rs *ReplicaSet) ReplicaDSNs() []string {
+	ret := make([]string, len(rs.Replicas))
+	for i, replica := range rs.Replicas {
+		ret[i] = replica.DSN()
+	}
+	return ret
+}
+
+// WaitCatchUp waits until all replicas have executed all transactions executed on the primary.
+// The wait timeout is the deadline of ctx, or DefaultCatchUpTimeout if it has none.
+func (rs *ReplicaSet) WaitCatchUp(ctx context.Context) error {
+	gtidSet, err := queryString(ctx, rs.Primary, "SELECT @@GLOBAL.gtid_executed")
+	if err != nil {
+		return err
+	}
+
+	timeout := DefaultCatchUpTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	seconds := int64(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	for i, replica := range rs.Replicas {
+		// NOTE: WAIT_FOR_EXECUTED_GTID_SET returns 0 on success, 1 on timeout.
+		ret, err := queryString(ctx, replica, fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET(%s, %d)", quoteString(gtidSet), seconds))
+		if err != nil {
+			return err
+		}
+		if ret != "0" {
+			return fmt.Errorf("tstmysql: replica %d catch up timeout", i)
+		}
+	}
+	return nil
+}
+
+// StopReplication stops replication of replica i.
+func (rs *ReplicaSet) StopReplication(ctx context.Context, i int) error {
+	return rs.Replicas[i].exec(ctx, "STOP SLAVE")
+}
+
+// StartReplication (re)starts replication of replica i.
+func (rs *ReplicaSet) StartReplication(ctx context.Context, i int) error {
+	return rs.Replicas[i].exec(ctx, "START SLAVE")
+}
+
+// Promote makes replica i the new primary: it stops replication on replica i and makes it writable, then makes
+// other replicas and the old primary replicate from it. The old primary takes position i in Replicas.
+// Call WaitCatchUp before if the replica may be lagging.
+func (rs *ReplicaSet) Promote(ctx context.Context, i int) error {
+	newPrimary := rs.Replicas[i]
+	if err := newPrimary.exec(ctx, "STOP SLAVE", "RESET SLAVE ALL", "SET GLOBAL read_only=OFF"); err != nil {
+		return err
+	}
+
+	oldPrimary := rs.Primary
+	rs.Primary, rs.Replicas[i] = newPrimary, oldPrimary
+
+	for j, replica := range rs.Replicas {
+		stmts := rs.changeMasterStmts(newPrimary)
+		if j != i {
+			stmts = append([]string{"STOP SLAVE"}, stmts...)
+		}
+		if err := replica.exec(ctx, stmts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes all containers and the network.
+func (rs *ReplicaSet) Close() error {
+	var ret error
+	for _, res := range rs.resources() {
+		if err := res.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	if rs.Network != nil {
+		if err := rs.Network.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+func queryString(ctx context.Context, res *Resource, query string) (string, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var ret sql.NullString
+	if err := db.QueryRowContext(ctx, query).Scan(&ret); err != nil {
+		return "", err
+	}
+	return ret.String, nil
+}
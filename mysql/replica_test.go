@@ -0,0 +1,82 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReplicaSet(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	rs, err := RunReplicaSet(nil, &Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			INSERT INTO users (name) VALUES ('ada');
+		`)},
+	}, 2)
+	if !assert.NoError(err) {
+		return
+	}
+	defer rs.Close()
+	assert.Equal(DefaultReplUser, rs.ReplUser)
+	assert.Equal(DefaultReplPassword, rs.ReplPassword)
+	for _, replica := range rs.Replicas {
+		assert.Equal(rs.ReplPassword, replica.Options.ReplPassword)
+	}
+	assert.Len(rs.ReplicaDSNs(), 2)
+
+	count := func(dsn string) int {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		n := 0
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	insert := func(dsn string) {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := db.Exec("INSERT INTO users (name) VALUES ('bob')"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// InitSQL should be replicated.
+	for _, dsn := range rs.ReplicaDSNs() {
+		assert.Equal(1, count(dsn))
+	}
+
+	// Stopped replica should not see new rows until restarted.
+	assert.NoError(rs.StopReplication(ctx, 0))
+	insert(rs.PrimaryDSN())
+	assert.Equal(1, count(rs.ReplicaDSNs()[0]))
+	assert.NoError(rs.StartReplication(ctx, 0))
+	assert.NoError(rs.WaitCatchUp(ctx))
+	for _, dsn := range rs.ReplicaDSNs() {
+		assert.Equal(2, count(dsn))
+	}
+
+	// Promote replica 1, the old primary becomes replica 1.
+	oldPrimary := rs.Primary
+	assert.NoError(rs.Promote(ctx, 1))
+	assert.Equal(oldPrimary, rs.Replicas[1])
+	insert(rs.PrimaryDSN())
+	assert.NoError(rs.WaitCatchUp(ctx))
+	for _, dsn := range rs.ReplicaDSNs() {
+		assert.Equal(3, count(dsn))
+	}
+}
@@ -0,0 +1,125 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// Reset truncates all tables (except Options.ResetExclude and Options.MigrationsTable) in DBName, which also resets
+// auto increments. Tables are truncated in dependency-safe order (referencing tables first) with foreign key checks
+// disabled.
+func (res *Resource) Reset(ctx context.Context) error {
+	db, err := res.rootClient()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return res.resetDatabase(ctx, db, res.Options.DBName)
+}
+
+// Reset truncates all tables (except Options.ResetExclude and Options.MigrationsTable) in the database,
+// see Resource.Reset.
+func (d *Database) Reset(ctx context.Context) error {
+	return d.res.resetDatabase(ctx, d.DB, d.Name)
+}
+
+func (res *Resource) resetDatabase(ctx context.Context, db *sql.DB, dbName string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tables, err := listTables(ctx, conn, dbName)
+	if err != nil {
+		return err
+	}
+	deps, err := listTableDeps(ctx, conn, dbName)
+	if err != nil {
+		return err
+	}
+
+	exclude := map[string]bool{
+		res.Options.MigrationsTable: true,
+	}
+	for _, table := range res.Options.ResetExclude {
+		exclude[table] = true
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET foreign_key_checks=0"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SET foreign_key_checks=1")
+
+	for _, table := range truncateOrder(tables, deps) {
+		if exclude[table] {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s.%s", quoteIdent(dbName), quoteIdent(table))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTableDeps returns a mapping from table to the tables it references by foreign keys in the database.
+func listTableDeps(ctx context.Context, q queryer, dbName string) (map[string][]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT DISTINCT TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA=? AND REFERENCED_TABLE_SCHEMA=?`, dbName, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := map[string][]string{}
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return nil, err
+		}
+		ret[table] = append(ret[table], referenced)
+	}
+	return ret, rows.Err()
+}
+
+// truncateOrder sorts tables so that referencing tables come before referenced tables. Cycles are broken arbitrarily
+// (but deterministically).
+func truncateOrder(tables []string, deps map[string][]string) []string {
+	tables = append([]string(nil), tables...)
+	sort.Strings(tables)
+
+	// Post-order DFS on the dependency graph gives referenced tables first, reverse it.
+	visited := map[string]bool{}
+	order := []string{}
+	var visit func(table string)
+	visit = func(table string) {
+		if visited[table] {
+			return
+		}
+		visited[table] = true
+		referenced := append([]string(nil), deps[table]...)
+		sort.Strings(referenced)
+		for _, r := range referenced {
+			visit(r)
+		}
+		order = append(order, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+
+	known := map[string]bool{}
+	for _, table := range tables {
+		known[table] = true
+	}
+	ret := make([]string, 0, len(tables))
+	for i := len(order) - 1; i >= 0; i-- {
+		if known[order[i]] {
+			ret = append(ret, order[i])
+		}
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+package tstmysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	// a <- b <- c, d standalone, e <-> f cycle.
+	tables := []string{"f", "e", "d", "c", "b", "a"}
+	deps := map[string][]string{
+		"b": {"a"},
+		"c": {"b", "x"}, // x is not in tables.
+		"e": {"f"},
+		"f": {"e"},
+	}
+	order := truncateOrder(tables, deps)
+	assert.Len(order, 6)
+
+	index := map[string]int{}
+	for i, table := range order {
+		index[table] = i
+	}
+	assert.True(index["c"] < index["b"])
+	assert.True(index["b"] < index["a"])
+	assert.Equal(order, truncateOrder(tables, deps))
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		ResetExclude: []string{"settings"},
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+			);
+			CREATE TABLE posts (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id INT UNSIGNED NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES users (id)
+			);
+			CREATE TABLE settings (
+				name VARCHAR(64) PRIMARY KEY
+			);
+			INSERT INTO settings VALUES ('x');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := db.Exec("INSERT INTO users VALUES ()")
+		assert.NoError(err)
+		_, err = db.Exec("INSERT INTO posts (user_id) VALUES (LAST_INSERT_ID())")
+		assert.NoError(err)
+
+		// Auto increments should be reset.
+		var id int
+		assert.NoError(db.QueryRow("SELECT MAX(id) FROM users").Scan(&id))
+		assert.Equal(1, id)
+
+		assert.NoError(res.Reset(ctx))
+
+		var n int
+		assert.NoError(db.QueryRow("SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM posts)").Scan(&n))
+		assert.Equal(0, n)
+		assert.NoError(db.QueryRow("SELECT COUNT(*) FROM settings").Scan(&n))
+		assert.Equal(1, n)
+	}
+}
@@ -0,0 +1,250 @@
+package tstmysql
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	// Environment variable to update golden files in Resource.AssertSchemaGolden, e.g. TSTSVC_UPDATE=1.
+	UpdateGoldenEnv = "TSTSVC_UPDATE"
+)
+
+var (
+	autoIncrementRegexp = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+	createTableRegexp   = regexp.MustCompile("(?i)^CREATE TABLE `((?:[^`]|``)+)`")
+)
+
+// Schema is normalized CREATE TABLE statements (without trailing ";") of a database keyed by table name.
+type Schema map[string]string
+
+// Tables returns table names in the schema, sorted.
+func (s Schema) Tables() []string {
+	ret := make([]string, 0, len(s))
+	for table := range s {
+		ret = append(ret, table)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// String returns CREATE TABLE statements sorted by table name, which can be parsed by ParseSchema.
+func (s Schema) String() string {
+	b := &strings.Builder{}
+	for i, table := range s.Tables() {
+		if i != 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(s[table])
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// ParseSchema parses CREATE TABLE statements (e.g. a golden file written from Schema.String).
+func ParseSchema(text string) (Schema, error) {
+	ret := Schema{}
+	for _, stmt := range SplitStatements(text) {
+		match := createTableRegexp.FindStringSubmatch(stmt.Text)
+		if match == nil {
+			return nil, fmt.Errorf("tstmysql: line %d: not a CREATE TABLE statement", stmt.Line)
+		}
+		ret[strings.Replace(match[1], "``", "`", -1)] = normalizeCreateTable(stmt.Text)
+	}
+	return ret, nil
+}
+
+// normalizeCreateTable strips auto increment counters and trailing spaces.
+func normalizeCreateTable(stmt string) string {
+	stmt = autoIncrementRegexp.ReplaceAllString(stmt, "")
+	lines := strings.Split(strings.TrimSpace(stmt), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffSchema returns a human readable difference between want and got, "" if they are the same.
+func DiffSchema(want, got Schema) string {
+	tables := map[string]bool{}
+	for table := range want {
+		tables[table] = true
+	}
+	for table := range got {
+		tables[table] = true
+	}
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	for _, table := range names {
+		w, inWant := want[table]
+		g, inGot := got[table]
+		switch {
+		case !inGot:
+			fmt.Fprintf(b, "table %s: missing\n", quoteIdent(table))
+		case !inWant:
+			fmt.Fprintf(b, "table %s: unexpected\n", quoteIdent(table))
+		case w != g:
+			fmt.Fprintf(b, "table %s:\n", quoteIdent(table))
+			for _, line := range diffLines(strings.Split(w, "\n"), strings.Split(g, "\n")) {
+				fmt.Fprintf(b, "  %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffLines returns lines of a and b prefixed by "-" (only in a), "+" (only in b) or " " (both),
+// based on the longest common subsequence.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ret := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "-"+a[i])
+			i++
+		default:
+			ret = append(ret, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, "+"+b[j])
+	}
+	return ret
+}
+
+// DumpSchema returns the normalized schema of tables in the database.
+func (res *Resource) DumpSchema(ctx context.Context, dbName string) (Schema, error) {
+	db, err := res.rootClient()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tables, err := listTables(ctx, conn, dbName)
+	if err != nil {
+		return nil, err
+	}
+	ret := Schema{}
+	for _, table := range tables {
+		var name, stmt string
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s.%s", quoteIdent(dbName), quoteIdent(table))).Scan(&name, &stmt); err != nil {
+			return nil, err
+		}
+		ret[table] = normalizeCreateTable(stmt)
+	}
+	return ret, nil
+}
+
+// DiffSchemas returns the difference between schemas of two databases, "" if they are the same.
+func (res *Resource) DiffSchemas(ctx context.Context, wantDBName, gotDBName string) (string, error) {
+	want, err := res.DumpSchema(ctx, wantDBName)
+	if err != nil {
+		return "", err
+	}
+	got, err := res.DumpSchema(ctx, gotDBName)
+	if err != nil {
+		return "", err
+	}
+	return DiffSchema(want, got), nil
+}
+
+// AssertSchemaGolden compares the schema of the database with the golden file, and reports differences by
+// t.Errorf. If environment variable UpdateGoldenEnv is true, or the "-update" flag is true, the golden file is
+// (re)written instead.
+// NOTE: The package does not define the "-update" flag (to avoid conflicts), define it in the test package to
+// use it:
+//
+//	var _ = flag.Bool("update", false, "update golden files")
+//
+// Then run "go test -update".
+func (res *Resource) AssertSchemaGolden(t testing.TB, dbName, path string) {
+	t.Helper()
+
+	got, err := res.DumpSchema(context.Background(), dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got.String()), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseSchema(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := DiffSchema(want, got); diff != "" {
+		t.Errorf("tstmysql: schema of %s differs from golden file %s:\n%s", dbName, path, diff)
+	}
+}
+
+// updateGolden returns true if golden files should be updated.
+func updateGolden() bool {
+	if update, _ := strconv.ParseBool(os.Getenv(UpdateGoldenEnv)); update {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if update, ok := getter.Get().(bool); ok {
+				return update
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package tstmysql
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestUpdateGolden(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(v bool) { *update = v }(*update)
+	defer os.Unsetenv(UpdateGoldenEnv)
+
+	*update = false
+	os.Unsetenv(UpdateGoldenEnv)
+	assert.False(updateGolden())
+
+	os.Setenv(UpdateGoldenEnv, "1")
+	assert.True(updateGolden())
+
+	os.Unsetenv(UpdateGoldenEnv)
+	*update = true
+	assert.True(updateGolden())
+}
+
+func TestDiffSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	want, err := ParseSchema("CREATE TABLE `a` (\n  `id` int NOT NULL\n) AUTO_INCREMENT=3;\nCREATE TABLE `b` (\n  `id` int NOT NULL\n);\n")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"a", "b"}, want.Tables())
+	assert.Equal("CREATE TABLE `a` (\n  `id` int NOT NULL\n);\n\nCREATE TABLE `b` (\n  `id` int NOT NULL\n);\n", want.String())
+
+	parsed, err := ParseSchema(want.String())
+	assert.NoError(err)
+	assert.Equal("", DiffSchema(want, parsed))
+
+	got := Schema{
+		"a": "CREATE TABLE `a` (\n  `id` int NOT NULL,\n  `name` text\n)",
+		"c": "CREATE TABLE `c` (\n)",
+	}
+	assert.Equal("table `a`:\n"+
+		"   CREATE TABLE `a` (\n"+
+		"  -  `id` int NOT NULL\n"+
+		"  +  `id` int NOT NULL,\n"+
+		"  +  `name` text\n"+
+		"   )\n"+
+		"table `b`: missing\n"+
+		"table `c`: unexpected\n", DiffSchema(want, got))
+
+	_, err = ParseSchema("DROP TABLE a;")
+	assert.Error(err)
+}
+
+func TestDumpSchema(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			CREATE TABLE posts (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id INT UNSIGNED NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES users (id)
+			);
+			INSERT INTO users (name) VALUES ('ada');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	res.AssertSchemaGolden(t, res.Options.DBName, "testdata/schema/users.sql")
+
+	// Update a golden file.
+	{
+		dir, err := ioutil.TempDir("", "tstmysql")
+		if !assert.NoError(err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "schema", "users.sql")
+
+		os.Setenv(UpdateGoldenEnv, "1")
+		res.AssertSchemaGolden(t, res.Options.DBName, path)
+		os.Unsetenv(UpdateGoldenEnv)
+		got, err := ioutil.ReadFile(path)
+		assert.NoError(err)
+		want, err := ioutil.ReadFile("testdata/schema/users.sql")
+		assert.NoError(err)
+		assert.Equal(string(want), string(got))
+		res.AssertSchemaGolden(t, res.Options.DBName, path)
+	}
+
+	d := res.NewDatabase(t)
+	diff, err := res.DiffSchemas(ctx, res.Options.DBName, d.Name)
+	assert.NoError(err)
+	assert.Equal("", diff)
+
+	_, err = d.DB.Exec("ALTER TABLE users ADD COLUMN email VARCHAR(64)")
+	assert.NoError(err)
+	diff, err = res.DiffSchemas(ctx, res.Options.DBName, d.Name)
+	assert.NoError(err)
+	assert.Contains(diff, "+  `email` varchar(64)")
+}
@@ -0,0 +1,262 @@
+package tstmysql
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ory/dockertest/v3"
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+var (
+	// Directory to cache data directory snapshots. Default: "tstsvc/tstmysql" in os.UserCacheDir().
+	SnapshotDir = ""
+)
+
+// snapshotDir returns the directory to cache data directory snapshots.
+func snapshotDir() (string, error) {
+	if SnapshotDir != "" {
+		return SnapshotDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tstsvc", "tstmysql"), nil
+}
+
+// snapshotKey returns a hash of everything affecting the initialized data directory.
+func (res *Resource) snapshotKey(repository string) (string, error) {
+	opts := &res.Options
+	key := struct {
+		Flavor          Flavor
+		Repository      string
+		Tag             string
+		DBName          string
+		RootPassword    string
+		User            string
+		Password        string
+		Users           []User
+		Binlog          bool
+		ServerID        uint32
+		ReplUser        string
+		ReplPassword    string
+		ServerVariables map[string]string
+		LoadTimeZones   bool
+		MyCnf           map[string]string
+		HostInitSQL     map[string]string
+		InitSQL         []Script
+		Migrations      []*Migration
+		MigrationsTable string
+	}{
+		Flavor:          opts.Flavor,
+		Repository:      repository,
+		Tag:             opts.Tag,
+		DBName:          opts.DBName,
+		RootPassword:    opts.RootPassword,
+		User:            opts.User,
+		Password:        opts.Password,
+		Users:           opts.Users,
+		Binlog:          opts.Binlog,
+		ServerID:        opts.ServerID,
+		ReplUser:        opts.ReplUser,
+		ReplPassword:    opts.ReplPassword,
+		ServerVariables: opts.ServerVariables,
+		LoadTimeZones:   opts.LoadTimeZones,
+		MyCnf:           map[string]string{},
+		HostInitSQL:     map[string]string{},
+		Migrations:      res.migrations,
+		MigrationsTable: opts.MigrationsTable,
+	}
+
+	files, err := res.myCnfFiles()
+	if err != nil {
+		return "", err
+	}
+	for name, data := range files {
+		key.MyCnf[name] = string(data)
+	}
+	if opts.HostInitSQLPath != "" {
+		entries, err := ioutil.ReadDir(opts.HostInitSQLPath)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(opts.HostInitSQLPath, entry.Name()))
+			if err != nil {
+				return "", err
+			}
+			key.HostInitSQL[entry.Name()] = string(data)
+		}
+	}
+	for _, source := range opts.InitSQL {
+		scripts, err := source.Scripts()
+		if err != nil {
+			return "", err
+		}
+		key.InitSQL = append(key.InitSQL, scripts...)
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// useSnapshot copies the cached data directory snapshot (created first if not exists) to a temporary directory,
+// and uses it as HostDataPath.
+func (res *Resource) useSnapshot(pool *dockertest.Pool, repository string) error {
+	opts := &res.Options
+	if opts.HostDataPath != "" {
+		return fmt.Errorf("tstmysql: Snapshot can't be used with HostDataPath")
+	}
+	if opts.RandomCredentials {
+		return fmt.Errorf("tstmysql: Snapshot can't be used with RandomCredentials")
+	}
+
+	key, err := res.snapshotKey(repository)
+	if err != nil {
+		return err
+	}
+	dir, err := snapshotDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, key+".tar")
+
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := res.createSnapshot(pool, path); err != nil {
+			return err
+		}
+	}
+
+	dataDir, err := res.tempDir()
+	if err != nil {
+		return err
+	}
+	if err := extractSnapshot(path, dataDir); err != nil {
+		return err
+	}
+	opts.HostDataPath = dataDir
+	return nil
+}
+
+// createSnapshot runs a seed server with the same options, shuts it down cleanly and saves its data directory
+// as a tar archive to path.
+func (res *Resource) createSnapshot(pool *dockertest.Pool, path string) error {
+	seedOpts := res.Options
+	seedOpts.Snapshot = false
+	seedOpts.HostPort = 0
+	seed, err := RunFromPool(pool, &seedOpts)
+	if err != nil {
+		return err
+	}
+	defer seed.Close()
+
+	// NOTE: Slow shutdown to make the data directory self-contained.
+	ctx := context.Background()
+	if err := seed.exec(ctx, "SET GLOBAL innodb_fast_shutdown=0"); err != nil && seedOpts.Flavor != TiDB {
+		return err
+	}
+	if err := seed.exec(ctx, "SHUTDOWN"); err != nil {
+		return err
+	}
+	if _, err := pool.Client.WaitContainer(seed.Container.ID); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	// Write to a temporary file first, then rename it, so that concurrent runs never see a partial snapshot.
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := pool.Client.DownloadFromContainer(seed.Container.ID, dc.DownloadFromContainerOptions{
+		Path:         seed.flavor.dataDir,
+		OutputStream: f,
+	}); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// extractSnapshot extracts a data directory snapshot to dir. The top level directory in the archive is stripped.
+func extractSnapshot(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := tar.NewReader(f)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(filepath.Clean(hdr.Name))
+		i := strings.Index(name, "/")
+		if i < 0 {
+			continue
+		}
+		name = name[i+1:]
+		if strings.HasPrefix(name, "../") {
+			return fmt.Errorf("tstmysql: bad snapshot entry %+q", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		// NOTE: Permissions are relaxed so that mysqld in the container can write.
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, r)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
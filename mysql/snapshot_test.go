@@ -0,0 +1,140 @@
+package tstmysql
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key := func(opts Options) string {
+		res := &Resource{Options: opts}
+		k, err := res.snapshotKey(Repository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	opts := Options{
+		Tag:     DefaultTag,
+		DBName:  DefaultDBName,
+		InitSQL: []InitSQL{InitSQLString("schema.sql", "CREATE TABLE xxx (id INT)")},
+	}
+	k := key(opts)
+	assert.Len(k, 64)
+	assert.Equal(k, key(opts))
+
+	opts2 := opts
+	opts2.InitSQL = []InitSQL{InitSQLString("schema.sql", "CREATE TABLE yyy (id INT)")}
+	assert.NotEqual(k, key(opts2))
+
+	opts3 := opts
+	opts3.ServerVariables = map[string]string{"lower_case_table_names": "1"}
+	assert.NotEqual(k, key(opts3))
+
+	// Ports do not matter.
+	opts4 := opts
+	opts4.HostPort = 13306
+	assert.Equal(k, key(opts4))
+}
+
+func TestExtractSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpDir, err := ioutil.TempDir("", "tstmysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "snapshot.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := tar.NewWriter(f)
+	for _, entry := range []struct {
+		name    string
+		content string
+	}{
+		{"mysql/", ""},
+		{"mysql/tst/", ""},
+		{"mysql/ibdata1", "ibdata"},
+		{"mysql/tst/xxx.ibd", "xxx"},
+	} {
+		hdr := &tar.Header{Name: entry.name, Mode: 0640, ModTime: time.Now()}
+		if entry.content == "" {
+			hdr.Typeflag = tar.TypeDir
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(entry.content))
+		}
+		assert.NoError(w.WriteHeader(hdr))
+		_, err := w.Write([]byte(entry.content))
+		assert.NoError(err)
+	}
+	assert.NoError(w.Close())
+	assert.NoError(f.Close())
+
+	dataDir := filepath.Join(tmpDir, "data")
+	assert.NoError(extractSnapshot(path, dataDir))
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "tst", "xxx.ibd"))
+	assert.NoError(err)
+	assert.Equal("xxx", string(data))
+	assert.FileExists(filepath.Join(dataDir, "ibdata1"))
+}
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpDir, err := ioutil.TempDir("", "tstmysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	SnapshotDir = tmpDir
+	defer func() { SnapshotDir = "" }()
+
+	opts := &Options{
+		Snapshot: true,
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+			);
+			INSERT INTO xxx VALUES ();
+		`)},
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := Run(opts)
+		if !assert.NoError(err) {
+			return
+		}
+
+		db, err := res.Client()
+		if assert.NoError(err) {
+			var n int
+			assert.NoError(db.QueryRow("SELECT COUNT(*) FROM xxx").Scan(&n))
+			assert.Equal(1, n)
+			db.Close()
+		}
+
+		// The copy of the data directory is removed.
+		dataDir := res.Options.HostDataPath
+		assert.NoError(res.Close())
+		_, err = os.Stat(dataDir)
+		assert.True(os.IsNotExist(err))
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(tmpDir, "*.tar"))
+	assert.NoError(err)
+	assert.Len(snapshots, 1)
+}
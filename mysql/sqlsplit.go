@@ -0,0 +1,143 @@
+package tstmysql
+
+import (
+	"strings"
+)
+
+// Statement is a single SQL statement split from a script.
+type Statement struct {
+	// Text of the statement without the trailing delimiter.
+	Text string
+
+	// Line number (1-based) where the statement starts in the script.
+	Line int
+}
+
+// SplitStatements splits a SQL script into statements. It understands quoted strings/identifiers,
+// comments ("-- ", "#" and "/* */") and the "DELIMITER" command of the mysql client, so that scripts
+// dumped by mysqldump or containing stored procedures can be split correctly. Statements containing
+// only comments are omitted, except executable comments ("/*! */").
+func SplitStatements(script string) []Statement {
+	ret := []Statement{}
+	delimiter := ";"
+	line := 1
+
+	start := 0          // Start offset of the current statement.
+	startLine := 1      // Start line of the current statement.
+	meaningful := false // Whether the current statement contains anything other than spaces/comments.
+	atLineStart := true
+
+	mark := func(i int) {
+		if !meaningful {
+			start = i
+			startLine = line
+			meaningful = true
+		}
+	}
+	emit := func(end int) {
+		if meaningful {
+			ret = append(ret, Statement{Text: strings.TrimSpace(script[start:end]), Line: startLine})
+		}
+		meaningful = false
+	}
+
+	i := 0
+	for i < len(script) {
+		c := script[i]
+
+		// DELIMITER command must be at line start (ignoring spaces).
+		if atLineStart && !meaningful {
+			j := i
+			for j < len(script) && (script[j] == ' ' || script[j] == '\t') {
+				j++
+			}
+			if hasPrefixFold(script[j:], "delimiter ") || hasPrefixFold(script[j:], "delimiter\t") {
+				end := strings.IndexByte(script[j:], '\n')
+				if end < 0 {
+					end = len(script)
+				} else {
+					end += j
+				}
+				if d := strings.TrimSpace(script[j+len("delimiter") : end]); d != "" {
+					delimiter = d
+				}
+				i = end
+				continue
+			}
+		}
+		atLineStart = false
+
+		switch {
+		case c == '\n':
+			line++
+			atLineStart = true
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '\'' || c == '"' || c == '`':
+			mark(i)
+			i++
+			for i < len(script) {
+				if script[i] == '\n' {
+					line++
+				}
+				if script[i] == '\\' && c != '`' {
+					if i+1 < len(script) && script[i+1] == '\n' {
+						line++
+					}
+					i += 2
+					continue
+				}
+				if script[i] == c {
+					// Doubled quote is an escaped quote.
+					if i+1 < len(script) && script[i+1] == c {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+
+		case c == '#' || (c == '-' && strings.HasPrefix(script[i:], "--") &&
+			(i+2 == len(script) || strings.IndexByte(" \t\r\n", script[i+2]) >= 0)):
+			// Line comment.
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if strings.HasPrefix(script[i:], "/*!") {
+				mark(i)
+			}
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 4
+			}
+			line += strings.Count(script[i:end], "\n")
+			i = end
+
+		case strings.HasPrefix(script[i:], delimiter):
+			emit(i)
+			i += len(delimiter)
+
+		default:
+			mark(i)
+			i++
+		}
+	}
+	emit(len(script))
+	return ret
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
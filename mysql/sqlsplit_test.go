@@ -0,0 +1,53 @@
+package tstmysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, testCase := range []struct {
+		Script string
+		Expect []Statement
+	}{
+		// Empty.
+		{"", []Statement{}},
+		{" \n -- comment\n # comment\n /* comment */ ;;", []Statement{}},
+		// Normal.
+		{
+			"SELECT 1;\nSELECT 2",
+			[]Statement{{"SELECT 1", 1}, {"SELECT 2", 2}},
+		},
+		// Quotes.
+		{
+			"SELECT 'a;b', \"c;\\\"d\", `e;``f`;\n\nSELECT 'g\n;h';SELECT 3;",
+			[]Statement{
+				{"SELECT 'a;b', \"c;\\\"d\", `e;``f`", 1},
+				{"SELECT 'g\n;h'", 3},
+				{"SELECT 3", 4},
+			},
+		},
+		// Comments.
+		{
+			"-- a;\nSELECT 1 /* ; */, 2 # ;\n;\n/*!40101 SET NAMES utf8 */;\nSELECT 1--2;",
+			[]Statement{
+				{"SELECT 1 /* ; */, 2 # ;", 2},
+				{"/*!40101 SET NAMES utf8 */", 4},
+				{"SELECT 1--2", 5},
+			},
+		},
+		// Delimiter.
+		{
+			"DELIMITER $$\nCREATE PROCEDURE p() BEGIN SELECT 1; END$$\n  delimiter ;\nCALL p();",
+			[]Statement{
+				{"CREATE PROCEDURE p() BEGIN SELECT 1; END", 2},
+				{"CALL p()", 4},
+			},
+		},
+	} {
+		assert.Equal(testCase.Expect, SplitStatements(testCase.Script), "script: %+q", testCase.Script)
+	}
+}
@@ -0,0 +1,12 @@
+-- Schema.
+CREATE TABLE xxx (
+	id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(64) NOT NULL
+);
+
+DELIMITER $$
+CREATE PROCEDURE add_xxx(IN n VARCHAR(64))
+BEGIN
+	INSERT INTO xxx (name) VALUES (n);
+END$$
+DELIMITER ;
@@ -0,0 +1,3 @@
+# Data.
+INSERT INTO xxx (name) VALUES ('ada');
+CALL add_xxx('bob');
@@ -0,0 +1,4 @@
+CREATE TABLE users (
+	id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(64) NOT NULL
+);
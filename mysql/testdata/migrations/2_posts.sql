@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE posts (
+	id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+	user_id INT UNSIGNED NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- +goose StatementBegin
+CREATE PROCEDURE count_posts()
+BEGIN
+	SELECT COUNT(*) FROM posts;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP PROCEDURE count_posts;
+DROP TABLE posts;
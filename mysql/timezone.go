@@ -0,0 +1,48 @@
+package tstmysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// loadTimeZones loads time zone tables from the system zoneinfo in the container.
+// NOTE: mysql_tzinfo_to_sql warns on some files (e.g. "zone.tab") to stderr, which is fine.
+func (res *Resource) loadTimeZones() error {
+	return res.execContainer([]string{
+		"sh", "-c", "mysql_tzinfo_to_sql /usr/share/zoneinfo | mysql -uroot mysql",
+	}, nil, nil)
+}
+
+// setTimeZone sets the global time_zone.
+func (res *Resource) setTimeZone(ctx context.Context) error {
+	return res.exec(ctx, fmt.Sprintf("SET GLOBAL time_zone=%s", quoteString(res.Options.TimeZone)))
+}
+
+// Valid range (in seconds since epoch) of session variable "timestamp".
+const (
+	minFakeTime = 1
+	maxFakeTime = 1<<31 - 1
+)
+
+// checkFakeTime checks t is in the valid range of session variable "timestamp".
+func checkFakeTime(t time.Time) error {
+	if t.IsZero() {
+		return nil
+	}
+	if t.Unix() < minFakeTime || t.Unix() > maxFakeTime {
+		return fmt.Errorf("tstmysql: FakeTime %s out of range", t.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// fakeTimestamp formats t as the value of session variable "timestamp".
+func fakeTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// WithFakeTime returns dsn with session variable "timestamp" set to t for all its sessions, so that NOW(),
+// CURRENT_TIMESTAMP() etc. return t (frozen). SYSDATE() is not affected.
+func WithFakeTime(dsn string, t time.Time) (string, error) {
+	return withSessionVariable(dsn, "timestamp", fakeTimestamp(t))
+}
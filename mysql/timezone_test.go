@@ -0,0 +1,88 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFakeTime(t *testing.T) {
+	assert := assert.New(t)
+
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	assert.Equal("1577934245.000006", fakeTimestamp(tm))
+
+	dsn, err := WithFakeTime("root:123456@tcp(localhost:3306)/tst", tm)
+	assert.NoError(err)
+	cfg, err := mysql.ParseDSN(dsn)
+	assert.NoError(err)
+	assert.Equal("1577934245.000006", cfg.Params["timestamp"])
+
+	// Only DSNs returned to callers use the fake time.
+	res := &Resource{Options: Options{
+		RootPassword: "123456",
+		DBName:       "tst",
+		HostPort:     3306,
+		FakeTime:     tm,
+	}}
+	cfg, err = mysql.ParseDSN(res.DSN())
+	assert.NoError(err)
+	assert.Equal("1577934245.000006", cfg.Params["timestamp"])
+	cfg, err = mysql.ParseDSN(res.rootDSN())
+	assert.NoError(err)
+	assert.Empty(cfg.Params["timestamp"])
+
+	// Out of range.
+	assert.NoError(checkFakeTime(time.Time{}))
+	assert.NoError(checkFakeTime(tm))
+	assert.Error(checkFakeTime(time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Error(checkFakeTime(time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestTimeZones(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	fakeTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	res, err := Run(&Options{
+		LoadTimeZones: true,
+		TimeZone:      "Asia/Shanghai",
+		FakeTime:      fakeTime,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	vars, err := res.Variables(ctx, "time_zone")
+	assert.NoError(err)
+	assert.Equal("Asia/Shanghai", vars["time_zone"])
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	var converted sql.NullString
+	assert.NoError(db.QueryRow("SELECT CONVERT_TZ('2020-01-02 03:04:05', 'UTC', 'Asia/Tokyo')").Scan(&converted))
+	assert.Equal("2020-01-02 12:04:05", converted.String)
+
+	var ts int64
+	assert.NoError(db.QueryRow("SELECT UNIX_TIMESTAMP(NOW())").Scan(&ts))
+	assert.Equal(fakeTime.Unix(), ts)
+
+	// New sessions see the new fake time.
+	res.Options.FakeTime = fakeTime.Add(time.Hour)
+	db2, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db2.Close()
+	assert.NoError(db2.QueryRow("SELECT UNIX_TIMESTAMP(NOW())").Scan(&ts))
+	assert.Equal(fakeTime.Add(time.Hour).Unix(), ts)
+}
@@ -0,0 +1,218 @@
+package tstmysql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/huangjunwen/tstsvc"
+)
+
+const (
+	// Directory in the container of generated certificates.
+	certsDir = "/etc/tstmysql-certs"
+
+	// Validity of generated certificates.
+	certValidity = 7 * 24 * time.Hour
+)
+
+// Certs is the host paths of generated certificates and keys (in PEM) when Options.TLS is true.
+type Certs struct {
+	CA         string
+	ServerCert string
+	ServerKey  string
+	ClientCert string
+	ClientKey  string
+}
+
+type certKey struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// generateCert generates a certificate signed by parent (self-signed if parent is nil).
+func generateCert(template *x509.Certificate, parent *certKey) (*certKey, error) {
+	// NOTE: RSA keys are used since some MySQL builds do not support EC keys.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(certValidity)
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &certKey{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}, nil
+}
+
+// generateCerts generates a CA, a server certificate for localhost and a client certificate.
+func generateCerts() (ca, server, client *certKey, err error) {
+	ca, err = generateCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "tstmysql CA"},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		return
+	}
+	server, err = generateCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	if err != nil {
+		return
+	}
+	client, err = generateCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "tstmysql client"},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	return
+}
+
+// setupTLS generates certificates to a temporary directory, returns mounts of them and mysqld options.
+func (res *Resource) setupTLS() (mounts []string, args []string, err error) {
+	ca, server, client, err := generateCerts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir, err := res.tempDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	res.certs = &Certs{
+		CA:         filepath.Join(dir, "ca.pem"),
+		ServerCert: filepath.Join(dir, "server-cert.pem"),
+		ServerKey:  filepath.Join(dir, "server-key.pem"),
+		ClientCert: filepath.Join(dir, "client-cert.pem"),
+		ClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+	files := []struct {
+		path string
+		data []byte
+	}{
+		{res.certs.CA, ca.certPEM},
+		{res.certs.ServerCert, server.certPEM},
+		{res.certs.ServerKey, server.keyPEM},
+		{res.certs.ClientCert, client.certPEM},
+		{res.certs.ClientKey, client.keyPEM},
+	}
+	for _, file := range files {
+		// NOTE: Readable by the mysql user in the container. These are throwaway keys.
+		if err := ioutil.WriteFile(file.path, file.data, 0644); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Mount files individually, since the temporary directory is not accessible by the mysql user.
+	vars := map[string]string{
+		"require_secure_transport": "ON",
+	}
+	for name, path := range map[string]string{
+		"ssl_ca":   res.certs.CA,
+		"ssl_cert": res.certs.ServerCert,
+		"ssl_key":  res.certs.ServerKey,
+	} {
+		target := fmt.Sprintf("%s/%s", certsDir, filepath.Base(path))
+		mounts = append(mounts, fmt.Sprintf("%s:%s:ro", path, target))
+		vars[name] = target
+	}
+	return mounts, serverVariableArgs(vars), nil
+}
+
+// registerTLS registers the TLS config for connections from the host.
+func (res *Resource) registerTLS() error {
+	data, err := ioutil.ReadFile(res.certs.CA)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return fmt.Errorf("tstmysql: bad CA certificate")
+	}
+	clientCert, err := tls.LoadX509KeyPair(res.certs.ClientCert, res.certs.ClientKey)
+	if err != nil {
+		return err
+	}
+
+	name := "tstmysql-" + strings.ToLower(tstsvc.RandomString(10))
+	if err := mysql.RegisterTLSConfig(name, &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+		ServerName:   "localhost",
+	}); err != nil {
+		return err
+	}
+	res.tlsName = name
+	return nil
+}
+
+func (res *Resource) deregisterTLS() {
+	if res.tlsName != "" {
+		mysql.DeregisterTLSConfig(res.tlsName)
+		res.tlsName = ""
+	}
+}
+
+// requireX509 makes User and Users connect with client certificates.
+func (res *Resource) requireX509(ctx context.Context) error {
+	stmts := []string{}
+	if res.Options.User != "" {
+		stmts = append(stmts, fmt.Sprintf("ALTER USER %s REQUIRE X509", quoteAccount(res.Options.User, "%")))
+	}
+	for _, user := range res.Options.Users {
+		stmts = append(stmts, fmt.Sprintf("ALTER USER %s REQUIRE X509", quoteAccount(user.Name, user.Host)))
+	}
+	return res.exec(ctx, stmts...)
+}
+
+// Certs returns host paths of the generated certificates, nil if Options.TLS is false.
+func (res *Resource) Certs() *Certs {
+	return res.certs
+}
+
+// TLSConfigName returns the name of the registered TLS config (see mysql.RegisterTLSConfig), which can be
+// used in the "tls" parameter of DSNs. It returns "" if Options.TLS is false.
+func (res *Resource) TLSConfigName() string {
+	return res.tlsName
+}
@@ -0,0 +1,85 @@
+package tstmysql
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCerts(t *testing.T) {
+	assert := assert.New(t)
+
+	ca, server, client, err := generateCerts()
+	if !assert.NoError(err) {
+		return
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	_, err = server.cert.Verify(x509.VerifyOptions{
+		DNSName:   "localhost",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(err)
+
+	_, err = client.cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(err)
+}
+
+func TestTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		User:        "tst",
+		TLS:         true,
+		RequireX509: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	assert.NotEmpty(res.TLSConfigName())
+	assert.FileExists(res.Certs().ClientCert)
+
+	ping := func(dsn string) error {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return db.Ping()
+	}
+
+	// Connected with TLS.
+	db, err := res.UserClient()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	var name, cipher string
+	assert.NoError(db.QueryRow("SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher))
+	assert.NotEmpty(cipher)
+
+	// Insecure transport is rejected.
+	cfg, err := mysql.ParseDSN(res.DSN())
+	if !assert.NoError(err) {
+		return
+	}
+	cfg.TLSConfig = ""
+	assert.Error(ping(cfg.FormatDSN()))
+
+	// User without client certificate is rejected.
+	cfg, err = mysql.ParseDSN(res.UserDSN())
+	if !assert.NoError(err) {
+		return
+	}
+	cfg.TLSConfig = "skip-verify"
+	assert.Error(ping(cfg.FormatDSN()))
+}
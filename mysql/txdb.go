@@ -0,0 +1,233 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errTxDBLost is returned by TxDB clients after the physical connection is lost (e.g. killed or timed out).
+var errTxDBLost = errors.New("tstmysql: TxDB connection lost, transaction gone")
+
+// txConnector creates connections all sharing one physical connection which runs inside a transaction.
+type txConnector struct {
+	mu     sync.Mutex
+	conn   driver.Conn
+	closed bool
+	broken bool
+	nSP    int
+}
+
+// txConn wraps the physical connection. Close is a no-op so that the physical connection (and the transaction)
+// survives when database/sql releases connections.
+type txConn struct {
+	c *txConnector
+}
+
+// txTx emulates (nested) transactions with savepoints.
+type txTx struct {
+	c    *txConnector
+	name string
+}
+
+var (
+	_ driver.Connector          = (*txConnector)(nil)
+	_ driver.Conn               = txConn{}
+	_ driver.ConnPrepareContext = txConn{}
+	_ driver.ConnBeginTx        = txConn{}
+	_ driver.ExecerContext      = txConn{}
+	_ driver.QueryerContext     = txConn{}
+	_ driver.NamedValueChecker  = txConn{}
+	_ driver.Validator          = txConn{}
+	_ driver.SessionResetter    = txConn{}
+)
+
+// TxDB returns a client (as root) to DBName whose statements all run inside a transaction which is rolled back
+// when t finished, so that each test sees the same database state without resetting it. Transactions started
+// from the client are emulated by savepoints.
+// NOTE: The client uses only one connection, and DDL statements cause implicit commits in MySQL.
+func (res *Resource) TxDB(t testing.TB) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := res.withFakeTime(res.localConfig("root", res.Options.RootPassword, res.Options.DBName))
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.(driver.ExecerContext).ExecContext(ctx, "START TRANSACTION", nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	c := &txConnector{conn: conn}
+	db := sql.OpenDB(c)
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	t.Cleanup(func() {
+		db.Close()
+		if err := c.close(ctx); err != nil {
+			t.Errorf("tstmysql: rollback TxDB error: %s", err)
+		}
+	})
+	return db
+}
+
+// Connect implements driver.Connector.
+func (c *txConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("tstmysql: TxDB closed")
+	}
+	if c.broken {
+		return nil, errTxDBLost
+	}
+	return txConn{c: c}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *txConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
+
+func (c *txConnector) close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.broken {
+		// The transaction is already gone.
+		c.conn.Close()
+		return nil
+	}
+	_, err := c.conn.(driver.ExecerContext).ExecContext(ctx, "ROLLBACK", nil)
+	c.conn.Close()
+	return err
+}
+
+func (c *txConnector) exec(ctx context.Context, query string) error {
+	_, err := c.conn.(driver.ExecerContext).ExecContext(ctx, query, nil)
+	return c.checkErr(err)
+}
+
+// checkErr marks the connector broken if err means the physical connection is lost. In that case
+// driver.ErrBadConn is returned so that database/sql retries with a new connection, which fails with
+// errTxDBLost since the transaction can't be recovered.
+func (c *txConnector) checkErr(err error) error {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		c.mu.Lock()
+		c.broken = true
+		c.mu.Unlock()
+		return driver.ErrBadConn
+	}
+	return err
+}
+
+// valid returns false if the physical connection is lost.
+func (c *txConnector) valid() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.broken {
+		if validator, ok := c.conn.(driver.Validator); ok && !validator.IsValid() {
+			c.broken = true
+		}
+	}
+	return !c.broken
+}
+
+// Prepare implements driver.Conn.
+func (conn txConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := conn.c.conn.Prepare(query)
+	return stmt, conn.c.checkErr(err)
+}
+
+// PrepareContext implements driver.ConnPrepareContext.
+func (conn txConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := conn.c.conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	return stmt, conn.c.checkErr(err)
+}
+
+// Close implements driver.Conn. It's a no-op.
+func (conn txConn) Close() error {
+	return nil
+}
+
+// Begin implements driver.Conn.
+func (conn txConn) Begin() (driver.Tx, error) {
+	return conn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx implements driver.ConnBeginTx. It creates a savepoint, so isolation levels and read-only
+// transactions are not supported.
+func (conn txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, fmt.Errorf("tstmysql: TxDB does not support isolation levels or read-only transactions")
+	}
+
+	conn.c.mu.Lock()
+	conn.c.nSP++
+	name := fmt.Sprintf("tstmysql_sp_%d", conn.c.nSP)
+	conn.c.mu.Unlock()
+
+	if err := conn.c.exec(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+	return &txTx{c: conn.c, name: name}, nil
+}
+
+// ExecContext implements driver.ExecerContext.
+func (conn txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := conn.c.conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	return result, conn.c.checkErr(err)
+}
+
+// QueryContext implements driver.QueryerContext.
+func (conn txConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := conn.c.conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	return rows, conn.c.checkErr(err)
+}
+
+// IsValid implements driver.Validator.
+func (conn txConn) IsValid() bool {
+	return conn.c.valid()
+}
+
+// ResetSession implements driver.SessionResetter.
+func (conn txConn) ResetSession(ctx context.Context) error {
+	if !conn.c.valid() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (conn txConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := conn.c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// Commit implements driver.Tx. It releases the savepoint.
+func (tx *txTx) Commit() error {
+	return tx.c.exec(context.Background(), "RELEASE SAVEPOINT "+tx.name)
+}
+
+// Rollback implements driver.Tx. It rolls back to the savepoint.
+func (tx *txTx) Rollback() error {
+	return tx.c.exec(context.Background(), "ROLLBACK TO SAVEPOINT "+tx.name)
+}
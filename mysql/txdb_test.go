@@ -0,0 +1,135 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxDB(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	for i := 0; i < 2; i++ {
+		t.Run("tx", func(t *testing.T) {
+			db := res.TxDB(t)
+
+			_, err := db.Exec("INSERT INTO xxx (name) VALUES (?)", "ada")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Nested transaction rolled back.
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.Exec("INSERT INTO xxx (name) VALUES (?)", "bob"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+
+			var n int
+			if err := db.QueryRow("SELECT COUNT(*) FROM xxx").Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Errorf("Expect 1 row but got %d", n)
+			}
+		})
+	}
+
+	// All rolled back.
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	var n int
+	assert.NoError(db.QueryRow("SELECT COUNT(*) FROM xxx").Scan(&n))
+	assert.Equal(0, n)
+}
+
+func TestTxConnector(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c := &txConnector{}
+	_, err := txConn{c: c}.BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+	assert.Error(err)
+	_, err = txConn{c: c}.BeginTx(ctx, driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)})
+	assert.Error(err)
+
+	// Connect fails fast after the physical connection is lost.
+	assert.Equal(driver.ErrBadConn, c.checkErr(driver.ErrBadConn))
+	_, err = c.Connect(ctx)
+	assert.Equal(errTxDBLost, err)
+}
+
+func TestTxDBLost(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	root, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer root.Close()
+
+	db := res.TxDB(t)
+	var id uint64
+	assert.NoError(db.QueryRow("SELECT CONNECTION_ID()").Scan(&id))
+	_, err = root.Exec(fmt.Sprintf("KILL %d", id))
+	assert.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec("SELECT 1")
+		if i > 0 {
+			assert.Equal(errTxDBLost, err)
+		} else {
+			assert.Error(err)
+		}
+	}
+}
+
+func TestTxDBFakeTime(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	res, err := Run(&Options{
+		FakeTime: fakeTime,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	db := res.TxDB(t)
+	var ts int64
+	assert.NoError(db.QueryRow("SELECT UNIX_TIMESTAMP(NOW())").Scan(&ts))
+	assert.Equal(fakeTime.Unix(), ts)
+}
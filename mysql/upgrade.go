@@ -0,0 +1,128 @@
+package tstmysql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+var versionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// Upgrade upgrades the test MySQL server to newTag on the same data: it shuts down the server cleanly, removes
+// the container (keeping HostDataPath or the data volume), starts newTag with the same options (and host port)
+// on the data, then runs mysql_upgrade if needed (MySQL/Percona before 8.0.16 and MariaDB; newer MySQL
+// upgrades itself at startup). res must not be used after, even if an error is returned, in which case
+// res is closed (removing its container, data volume and temporary directories).
+// Migrations not applied yet are applied to the upgraded server, while InitSQL etc. are not executed again.
+func Upgrade(res *Resource, newTag string) (*Resource, error) {
+	ctx := context.Background()
+	pool := res.pool
+
+	// On errors before the new server starts, res is closed (with its data) since it can't be used anymore.
+	fail := func(err error) (*Resource, error) {
+		res.Close()
+		return nil, err
+	}
+
+	if res.Options.Flavor == TiDB {
+		return fail(fmt.Errorf("tstmysql: Upgrade is not supported by flavor %s", res.Options.Flavor))
+	}
+
+	// Find the data volume.
+	dataVolume := ""
+	if res.Options.HostDataPath == "" {
+		container, err := pool.Client.InspectContainer(res.Container.ID)
+		if err != nil {
+			return fail(err)
+		}
+		for _, mount := range container.Mounts {
+			if mount.Destination == res.flavor.dataDir {
+				dataVolume = mount.Name
+			}
+		}
+		if dataVolume == "" {
+			return fail(fmt.Errorf("tstmysql: data volume not found"))
+		}
+	}
+
+	// Shutdown cleanly. A slow shutdown is needed by some upgrades (e.g. 5.7 to 8.0).
+	if err := res.exec(ctx, "SET GLOBAL innodb_fast_shutdown=0"); err != nil {
+		return fail(err)
+	}
+	if err := res.exec(ctx, "SHUTDOWN"); err != nil {
+		return fail(err)
+	}
+	if _, err := pool.Client.WaitContainer(res.Container.ID); err != nil {
+		return fail(err)
+	}
+
+	// Remove the container but keep the data.
+	res.deregisterTLS()
+	if err := res.tracker.Close(func() error {
+		return pool.Client.RemoveContainer(dc.RemoveContainerOptions{
+			ID:    res.Container.ID,
+			Force: true,
+		})
+	}); err != nil {
+		return fail(err)
+	}
+
+	// Temporary directories (which may contain the data directory) are passed to the new Resource.
+	tempDirs := res.tempDirs
+	res.tempDirs = nil
+	res.volumes = nil
+
+	opts := res.Options
+	opts.Tag = newTag
+	opts.Snapshot = false
+	newRes, err := runFromPool(pool, &opts, dataVolume)
+	if err != nil {
+		for _, dir := range tempDirs {
+			os.RemoveAll(dir)
+		}
+		if dataVolume != "" {
+			pool.Client.RemoveVolume(dataVolume)
+		}
+		return nil, err
+	}
+	newRes.tempDirs = append(newRes.tempDirs, tempDirs...)
+
+	// Run mysql_upgrade if needed.
+	version, err := queryString(ctx, newRes, "SELECT VERSION()")
+	if err != nil {
+		newRes.Close()
+		return nil, err
+	}
+	if needsMySQLUpgrade(opts.Flavor, version) {
+		if err := newRes.execContainer([]string{"mysql_upgrade", "-uroot"}, nil, nil); err != nil {
+			newRes.Close()
+			return nil, err
+		}
+	}
+	return newRes, nil
+}
+
+// needsMySQLUpgrade returns true if mysql_upgrade should be run for the server version.
+func needsMySQLUpgrade(flavor Flavor, version string) bool {
+	switch flavor {
+	case TiDB:
+		return false
+	case MariaDB:
+		return true
+	}
+
+	// MySQL 8.0.16+ upgrades data dictionary and system tables at startup, and mysql_upgrade is deprecated.
+	match := versionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return true
+	}
+	v := [3]int{}
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	return v[0] < 8 || (v[0] == 8 && v[1] == 0 && v[2] < 16)
+}
@@ -0,0 +1,61 @@
+package tstmysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedsMySQLUpgrade(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(needsMySQLUpgrade(MySQL, "5.7.30-log"))
+	assert.True(needsMySQLUpgrade(MySQL, "8.0.15"))
+	assert.False(needsMySQLUpgrade(MySQL, "8.0.16"))
+	assert.False(needsMySQLUpgrade(Percona, "8.0.25-15"))
+	assert.False(needsMySQLUpgrade(MySQL, "8.1.0"))
+	assert.True(needsMySQLUpgrade(MariaDB, "10.6.5-MariaDB-1:10.6.5+maria~focal"))
+	assert.False(needsMySQLUpgrade(TiDB, "5.7.25-TiDB-v5.0.1"))
+}
+
+func TestUpgrade(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{
+		Tag: "5.7",
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE xxx (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			);
+			INSERT INTO xxx (name) VALUES ('ada');
+		`)},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	dsn := res.DSN()
+
+	res, err = Upgrade(res, "8.0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	assert.Equal(dsn, res.DSN())
+
+	version, err := queryString(ctx, res, "SELECT VERSION()")
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(version, "8.0"), version)
+
+	db, err := res.Client()
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	var name string
+	assert.NoError(db.QueryRow("SELECT name FROM xxx WHERE id=1").Scan(&name))
+	assert.Equal("ada", name)
+}
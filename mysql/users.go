@@ -0,0 +1,125 @@
+package tstmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/huangjunwen/tstsvc"
+)
+
+// User is a (non-root) user created when the MySQL server starts.
+type User struct {
+	// Name of the user.
+	Name string
+
+	// Password of the user. Default: DefaultPassword, or a random one if Options.RandomCredentials is true.
+	Password string
+
+	// Host part of the account. Default: "%".
+	Host string
+
+	// Privileges granted to the user.
+	Grants []Grant
+}
+
+// Grant is privileges on a database or table.
+type Grant struct {
+	// Privileges, e.g. "SELECT", "INSERT", "ALL PRIVILEGES".
+	Privileges []string
+
+	// The database, "*" for all databases. Default: Options.DBName.
+	Database string
+
+	// The table, "*" for all tables in Database. Default: "*".
+	Table string
+}
+
+// resolveUsers copies users with defaults filled.
+func (opts *Options) resolveUsers() {
+	users := make([]User, len(opts.Users))
+	for i, user := range opts.Users {
+		if user.Password == "" {
+			if opts.RandomCredentials {
+				user.Password = tstsvc.RandomString(RandomPasswordLength)
+			} else {
+				user.Password = DefaultPassword
+			}
+		}
+		if user.Host == "" {
+			user.Host = "%"
+		}
+		grants := make([]Grant, len(user.Grants))
+		for j, grant := range user.Grants {
+			if grant.Database == "" {
+				grant.Database = opts.DBName
+			}
+			if grant.Table == "" {
+				grant.Table = "*"
+			}
+			grants[j] = grant
+		}
+		user.Grants = grants
+		users[i] = user
+	}
+	opts.Users = users
+}
+
+// statements returns statements to create the user and grant privileges.
+func (user *User) statements() []string {
+	account := quoteAccount(user.Name, user.Host)
+	ret := []string{
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %s IDENTIFIED BY %s", account, quoteString(user.Password)),
+	}
+	for _, grant := range user.Grants {
+		ret = append(ret, fmt.Sprintf("GRANT %s ON %s.%s TO %s",
+			strings.Join(grant.Privileges, ", "), quoteGrantIdent(grant.Database), quoteGrantIdent(grant.Table), account))
+	}
+	return ret
+}
+
+func quoteGrantIdent(ident string) string {
+	if ident == "*" {
+		return ident
+	}
+	return quoteIdent(ident)
+}
+
+// createUsers creates Options.Users.
+func (res *Resource) createUsers(ctx context.Context) error {
+	if len(res.Options.Users) == 0 {
+		return nil
+	}
+	stmts := []string{}
+	for i := range res.Options.Users {
+		stmts = append(stmts, res.Options.Users[i].statements()...)
+	}
+	return res.exec(ctx, stmts...)
+}
+
+// DSNFor returns the data source name (in DBName) of the user, which is "root", Options.User or one of
+// Options.Users. It returns "" if the user is unknown.
+func (res *Resource) DSNFor(name string) string {
+	switch name {
+	case "root":
+		return res.DSN()
+	case res.Options.User:
+		return res.UserDSN()
+	}
+	for _, user := range res.Options.Users {
+		if user.Name == name {
+			return res.withFakeTime(res.localConfig(user.Name, user.Password, res.Options.DBName)).FormatDSN()
+		}
+	}
+	return ""
+}
+
+// ClientFor returns a client (in DBName) as the user, see DSNFor.
+func (res *Resource) ClientFor(name string) (*sql.DB, error) {
+	dsn := res.DSNFor(name)
+	if dsn == "" {
+		return nil, fmt.Errorf("tstmysql: unknown user %+q", name)
+	}
+	return sql.Open("mysql", dsn)
+}
@@ -0,0 +1,96 @@
+package tstmysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStatements(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := &Options{
+		DBName: "app",
+		Users: []User{
+			{
+				Name: "reader",
+				Grants: []Grant{
+					{Privileges: []string{"SELECT"}},
+					{Privileges: []string{"SELECT", "INSERT"}, Table: "logs"},
+					{Privileges: []string{"PROCESS"}, Database: "*"},
+				},
+			},
+		},
+	}
+	opts.resolveUsers()
+	assert.Equal([]string{
+		"CREATE USER IF NOT EXISTS 'reader'@'%' IDENTIFIED BY '123456'",
+		"GRANT SELECT ON `app`.* TO 'reader'@'%'",
+		"GRANT SELECT, INSERT ON `app`.`logs` TO 'reader'@'%'",
+		"GRANT PROCESS ON *.* TO 'reader'@'%'",
+	}, opts.Users[0].statements())
+
+	// Quoted.
+	user := &User{Name: "o'neil", Password: `a'b\c`, Host: "%"}
+	assert.Equal([]string{
+		`CREATE USER IF NOT EXISTS 'o''neil'@'%' IDENTIFIED BY 'a''b\\c'`,
+	}, user.statements())
+}
+
+func TestUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Run(&Options{
+		RandomCredentials: true,
+		InitSQL: []InitSQL{InitSQLString("schema.sql", `
+			CREATE TABLE users (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+			);
+			CREATE TABLE logs (
+				id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+			);
+		`)},
+		Users: []User{
+			{
+				Name: "reader",
+				Grants: []Grant{
+					{Privileges: []string{"SELECT"}},
+				},
+			},
+			{
+				Name: "logger",
+				Grants: []Grant{
+					{Privileges: []string{"INSERT"}, Table: "logs"},
+				},
+			},
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+
+	assert.Empty(res.DSNFor("nobody"))
+	_, err = res.ClientFor("nobody")
+	assert.Error(err)
+
+	reader, err := res.ClientFor("reader")
+	if !assert.NoError(err) {
+		return
+	}
+	defer reader.Close()
+	var n int
+	assert.NoError(reader.QueryRow("SELECT COUNT(*) FROM users").Scan(&n))
+	_, err = reader.Exec("INSERT INTO users VALUES ()")
+	assert.Error(err)
+
+	logger, err := res.ClientFor("logger")
+	if !assert.NoError(err) {
+		return
+	}
+	defer logger.Close()
+	_, err = logger.Exec("INSERT INTO logs VALUES ()")
+	assert.NoError(err)
+	_, err = logger.Exec("INSERT INTO users VALUES ()")
+	assert.Error(err)
+}
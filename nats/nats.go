@@ -2,6 +2,9 @@ package tstnats
 
 import (
 	"fmt"
+	"io"
+	"net/url"
+	"testing"
 
 	nats "github.com/nats-io/nats.go"
 	"github.com/ory/dockertest/v3"
@@ -19,6 +22,13 @@ var (
 
 	// Default container expire time.
 	DefaultExpire uint = 120
+
+	// Default command of the container if BaseRunOptions.Cmd is empty and authentication flags need to be added.
+	// It's the same as the CMD of the official image.
+	DefaultCmd = []string{"nats-server", "--config", "/etc/nats/nats-server.conf"}
+
+	// Length of random generated passwords/tokens.
+	RandomPasswordLength = 16
 )
 
 var (
@@ -33,6 +43,8 @@ type Resource struct {
 
 	// Actual options.
 	Options
+
+	tracker *tstsvc.Tracker
 }
 
 // Options is options to run a test nats server.
@@ -40,6 +52,19 @@ type Options struct {
 	// Tag of the repository. Default: DefaultTag.
 	Tag string
 
+	// If specified, clients must authenticate with User/Password. Default: "".
+	User string
+
+	// The password of User. Default: "", or a random one if RandomCredentials is true and User is specified.
+	Password string
+
+	// If specified, clients must authenticate with this token. Can't be used with User.
+	// Default: "", or a random one if RandomCredentials is true and User is not specified.
+	Token string
+
+	// If true, generate random password/token per Resource. Default: false.
+	RandomCredentials bool
+
 	// If specified, the port 4222/tcp will be mapped to it. Default: random port.
 	HostPort uint16
 
@@ -81,6 +106,18 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	if opts.Tag == "" {
 		opts.Tag = DefaultTag
 	}
+	if opts.User != "" && opts.Token != "" {
+		return nil, fmt.Errorf("tstnats: User and Token can't be both specified")
+	}
+	if opts.RandomCredentials {
+		if opts.User != "" {
+			if opts.Password == "" {
+				opts.Password = tstsvc.RandomString(RandomPasswordLength)
+			}
+		} else if opts.Token == "" {
+			opts.Token = tstsvc.RandomString(RandomPasswordLength)
+		}
+	}
 	if opts.HostPort == 0 {
 		opts.HostPort = tstsvc.FreePort()
 	}
@@ -96,11 +133,22 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 
 	// Copy and collect RunOptions.
 	runOpts := opts.BaseRunOptions
+	runOpts.Cmd = append([]string(nil), runOpts.Cmd...)
 
 	if runOpts.Repository == "" {
 		runOpts.Repository = Repository
 	}
 	runOpts.Tag = opts.Tag
+	if opts.User != "" || opts.Token != "" {
+		if len(runOpts.Cmd) == 0 {
+			runOpts.Cmd = append(runOpts.Cmd, DefaultCmd...)
+		}
+		if opts.User != "" {
+			runOpts.Cmd = append(runOpts.Cmd, "--user", opts.User, "--pass", opts.Password)
+		} else {
+			runOpts.Cmd = append(runOpts.Cmd, "--auth", opts.Token)
+		}
+	}
 	runOpts.PortBindings = map[dc.Port][]dc.PortBinding{
 		"4222/tcp": []dc.PortBinding{
 			dc.PortBinding{
@@ -122,11 +170,18 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		},
 	}
 
+	// Track timings.
+	res.tracker = tstsvc.Track("nats", runOpts.Repository, runOpts.Tag)
+	if err := res.tracker.Pull(pool, runOpts.Repository, runOpts.Tag, runOpts.Auth); err != nil {
+		return nil, err
+	}
+
 	var err error
 	res.Resource, err = pool.RunWithOptions(&runOpts)
 	if err != nil {
 		return nil, err
 	}
+	res.tracker.Created(res.Resource)
 
 	// Set expire of the container.
 	res.Resource.Expire(opts.Expire)
@@ -143,16 +198,72 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		res.Close()
 		return nil, err
 	}
+	res.tracker.Ready(pool, res.Resource)
 
 	return res, nil
 }
 
-// NatsURL returns the nats url to connect to the nats streaming server.
+// Close removes the container.
+func (res *Resource) Close() error {
+	return res.tracker.Close(res.Resource.Close)
+}
+
+// NatsURL returns the nats url (with credentials if any) to connect to the nats server.
 func (res *Resource) NatsURL() string {
-	return fmt.Sprintf("nats://localhost:%d", res.Options.HostPort)
+	return res.natsURL(fmt.Sprintf("localhost:%d", res.Options.HostPort))
 }
 
 // NatsClient returns a nats client of the embedded nats server of the test nats streaming server.
 func (res *Resource) NatsClient(opts ...nats.Option) (*nats.Conn, error) {
 	return nats.Connect(res.NatsURL(), opts...)
 }
+
+// NetworkNatsURL returns the nats url to connect to the test nats server from another container
+// in the same docker network.
+func (res *Resource) NetworkNatsURL() string {
+	return res.natsURL(fmt.Sprintf("%s:4222", tstsvc.ContainerName(res.Resource)))
+}
+
+func (res *Resource) natsURL(host string) string {
+	u := &url.URL{
+		Scheme: "nats",
+		Host:   host,
+	}
+	if res.Options.User != "" {
+		u.User = url.UserPassword(res.Options.User, res.Options.Password)
+	} else if res.Options.Token != "" {
+		u.User = url.User(res.Options.Token)
+	}
+	return u.String()
+}
+
+// NetworkEnv implements tstsvc.NetworkEnver.
+func (res *Resource) NetworkEnv() map[string]string {
+	return map[string]string{
+		"NATS_URL": res.NetworkNatsURL(),
+	}
+}
+
+// Export implements tstsvc.Exporter.
+func (res *Resource) Export() map[string]string {
+	return map[string]string{
+		"NATS_URL": res.NatsURL(),
+	}
+}
+
+// Matrix runs f as a subtest against a test nats server for each tag. tags can be overrided by
+// environment variable TSTSVC_NATS_TAGS (comma separated) and DefaultTag is used if both are empty.
+// opts is used as the base options of each server (with Tag replaced), nil for the default options.
+// If parallel is true, the subtests are run in parallel, in which case HostXXXPort in opts should be zero.
+func Matrix(t *testing.T, tags []string, parallel bool, opts *Options, f func(t *testing.T, res *Resource)) {
+	if opts == nil {
+		opts = defaultOptions
+	}
+	tstsvc.MatrixResources(t, "nats", tags, DefaultTag, parallel, func(tag string) (io.Closer, error) {
+		o := *opts
+		o.Tag = tag
+		return Run(&o)
+	}, func(t *testing.T, res io.Closer) {
+		f(t, res.(*Resource))
+	})
+}
@@ -1,6 +1,7 @@
 package tstnats
 
 import (
+	"fmt"
 	"log"
 	"testing"
 	"time"
@@ -91,3 +92,42 @@ func TestRun(t *testing.T) {
 	}
 	log.Printf("Publishd again to %+q and handled.\n", subject)
 }
+
+func TestRandomCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, opts := range []*Options{
+		{RandomCredentials: true},
+		{RandomCredentials: true, User: "tst"},
+	} {
+		res, err := Run(opts)
+		if !assert.NoError(err) {
+			continue
+		}
+		log.Printf("The nats server is up, nats url: %+q.\n", res.NatsURL())
+
+		// Connect with credentials.
+		nc, err := res.NatsClient()
+		if assert.NoError(err) {
+			nc.Close()
+		}
+
+		// Connect without credentials.
+		_, err = nats.Connect(fmt.Sprintf("nats://localhost:%d", res.Options.HostPort))
+		assert.Error(err)
+
+		res.Close()
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	Matrix(t, nil, false, nil, func(t *testing.T, res *Resource) {
+		nc, err := res.NatsClient()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer nc.Close()
+		assert.NoError(t, nc.Flush())
+		log.Printf("Nats server %s is up, nats url: %+q.\n", res.Options.Tag, res.NatsURL())
+	})
+}
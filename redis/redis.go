@@ -3,6 +3,8 @@ package tstredis
 import (
 	"context"
 	"fmt"
+	"io"
+	"testing"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/ory/dockertest/v3"
@@ -20,6 +22,9 @@ var (
 
 	// Default container expire time.
 	DefaultExpire uint = 120
+
+	// Length of random generated passwords.
+	RandomPasswordLength = 16
 )
 
 var (
@@ -34,6 +39,8 @@ type Resource struct {
 
 	// Actual options.
 	Options
+
+	tracker *tstsvc.Tracker
 }
 
 // Options is options to run a redis test server.
@@ -44,6 +51,13 @@ type Options struct {
 	// If specified, data will be stored in this host directory.
 	HostDataPath string
 
+	// If specified, clients must authenticate with this password (requirepass).
+	// Default: "", or a random one if RandomCredentials is true.
+	Password string
+
+	// If true, generate a random password per Resource. Default: false.
+	RandomCredentials bool
+
 	// If specified, the port 6379/tcp will be mapped to it. Default: random port.
 	HostPort uint16
 
@@ -79,6 +93,9 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	if opts.Tag == "" {
 		opts.Tag = DefaultTag
 	}
+	if opts.RandomCredentials && opts.Password == "" {
+		opts.Password = tstsvc.RandomString(RandomPasswordLength)
+	}
 	if opts.HostPort == 0 {
 		opts.HostPort = tstsvc.FreePort()
 	}
@@ -88,12 +105,16 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 
 	// Copy and collect RunOptions.
 	runOpts := opts.BaseRunOptions
+	runOpts.Cmd = append([]string(nil), runOpts.Cmd...)
 	runOpts.Mounts = append([]string(nil), runOpts.Mounts...)
 
 	if runOpts.Repository == "" {
 		runOpts.Repository = Repository
 	}
 	runOpts.Tag = opts.Tag
+	if opts.Password != "" {
+		runOpts.Cmd = append(runOpts.Cmd, "--requirepass", opts.Password)
+	}
 	if opts.HostDataPath != "" {
 		runOpts.Mounts = append(runOpts.Mounts, fmt.Sprintf("%s:/data", opts.HostDataPath))
 	}
@@ -106,11 +127,18 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		},
 	}
 
+	// Track timings.
+	res.tracker = tstsvc.Track("redis", runOpts.Repository, runOpts.Tag)
+	if err := res.tracker.Pull(pool, runOpts.Repository, runOpts.Tag, runOpts.Auth); err != nil {
+		return nil, err
+	}
+
 	var err error
 	res.Resource, err = pool.RunWithOptions(&runOpts)
 	if err != nil {
 		return nil, err
 	}
+	res.tracker.Created(res.Resource)
 
 	// Set expire of the container.
 	res.Resource.Expire(opts.Expire)
@@ -124,10 +152,16 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		res.Close()
 		return nil, err
 	}
+	res.tracker.Ready(pool, res.Resource)
 
 	return res, nil
 }
 
+// Close removes the container.
+func (res *Resource) Close() error {
+	return res.tracker.Close(res.Resource.Close)
+}
+
 // Addr returns the addr to connect to the test server.
 func (res *Resource) Addr() string {
 	return fmt.Sprintf("localhost:%d", res.Options.HostPort)
@@ -136,6 +170,45 @@ func (res *Resource) Addr() string {
 // Client returns a redis client to the test server.
 func (res *Resource) Client() *redis.Client {
 	return redis.NewClient(&redis.Options{
-		Addr: res.Addr(),
+		Addr:     res.Addr(),
+		Password: res.Options.Password,
+	})
+}
+
+// NetworkAddr returns the addr to connect to the test server from another container in the same docker network.
+func (res *Resource) NetworkAddr() string {
+	return fmt.Sprintf("%s:6379", tstsvc.ContainerName(res.Resource))
+}
+
+// NetworkEnv implements tstsvc.NetworkEnver.
+func (res *Resource) NetworkEnv() map[string]string {
+	return map[string]string{
+		"REDIS_ADDR":     res.NetworkAddr(),
+		"REDIS_PASSWORD": res.Options.Password,
+	}
+}
+
+// Export implements tstsvc.Exporter.
+func (res *Resource) Export() map[string]string {
+	return map[string]string{
+		"REDIS_ADDR":     res.Addr(),
+		"REDIS_PASSWORD": res.Options.Password,
+	}
+}
+
+// Matrix runs f as a subtest against a test redis server for each tag. tags can be overrided by
+// environment variable TSTSVC_REDIS_TAGS (comma separated) and DefaultTag is used if both are empty.
+// opts is used as the base options of each server (with Tag replaced), nil for the default options.
+// If parallel is true, the subtests are run in parallel, in which case HostXXXPort in opts should be zero.
+func Matrix(t *testing.T, tags []string, parallel bool, opts *Options, f func(t *testing.T, res *Resource)) {
+	if opts == nil {
+		opts = defaultOptions
+	}
+	tstsvc.MatrixResources(t, "redis", tags, DefaultTag, parallel, func(tag string) (io.Closer, error) {
+		o := *opts
+		o.Tag = tag
+		return Run(&o)
+	}, func(t *testing.T, res io.Closer) {
+		f(t, res.(*Resource))
 	})
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -82,3 +83,32 @@ func TestRun(t *testing.T) {
 		assert.Equal(value, v)
 	}
 }
+
+func TestMatrix(t *testing.T) {
+	Matrix(t, []string{"5.0.10-alpine", DefaultTag}, true, nil, func(t *testing.T, res *Resource) {
+		client := res.Client()
+		defer client.Close()
+		assert.NoError(t, client.Ping(context.Background()).Err())
+		log.Printf("Redis server %s is up, addr: %+q.\n", res.Options.Tag, res.Addr())
+	})
+}
+
+func TestRandomCredentials(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	res, err := Run(&Options{RandomCredentials: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer res.Close()
+	assert.NotEmpty(res.Options.Password)
+
+	client := res.Client()
+	defer client.Close()
+	assert.NoError(client.Ping(ctx).Err())
+
+	noauth := redis.NewClient(&redis.Options{Addr: res.Addr()})
+	defer noauth.Close()
+	assert.Error(noauth.Ping(ctx).Err())
+}
@@ -0,0 +1,372 @@
+package tstsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+var (
+	trackersMu   sync.Mutex
+	trackers     []*Tracker
+	statsEnabled = os.Getenv("TSTSVC_STATS") != ""
+)
+
+// Timing is the timings (and optionally resource usage) of a test resource.
+type Timing struct {
+	// Service name, e.g. "mysql".
+	Service string `json:"service"`
+
+	// Image in "repository:tag" form.
+	Image string `json:"image"`
+
+	// Short container id.
+	Container string `json:"container,omitempty"`
+
+	// When the resource starts to run.
+	Start time.Time `json:"start"`
+
+	// Time spent on pulling image, zero if the image exists already.
+	Pull time.Duration `json:"pull"`
+
+	// Time spent on creating and starting the container.
+	Create time.Duration `json:"create"`
+
+	// Time spent on waiting the service ready after the container started.
+	Ready time.Duration `json:"ready"`
+
+	// Time spent on closing the resource.
+	Close time.Duration `json:"close"`
+
+	// Container stats, only available if stats sampling is enabled.
+	Stats *Stats `json:"stats,omitempty"`
+}
+
+// Stats is the summary of container stats samples.
+type Stats struct {
+	// Number of samples.
+	Samples int `json:"samples"`
+
+	// Average CPU usage in percent (100 means one CPU core).
+	CPUAvg float64 `json:"cpu_avg"`
+
+	// Max CPU usage in percent (100 means one CPU core).
+	CPUMax float64 `json:"cpu_max"`
+
+	// Max memory usage in bytes.
+	MemMax uint64 `json:"mem_max"`
+}
+
+// Tracker records timings of a test resource. All methods are safe to be called on nil Tracker.
+type Tracker struct {
+	mu      sync.Mutex
+	timing  Timing
+	phaseAt time.Time
+	done    chan bool
+	wg      sync.WaitGroup
+}
+
+// EnableStats enables/disables sampling container CPU/memory usage through docker stats API for resources
+// run after this call. It can also be enabled by setting environment variable TSTSVC_STATS.
+func EnableStats(enabled bool) {
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	statsEnabled = enabled
+}
+
+// Track starts tracking a new test resource of the service. The resource is added to the report when it's
+// ready, so failed runs (e.g. pull errors or readiness timeouts) are not reported.
+func Track(service, repository, tag string) *Tracker {
+	now := time.Now()
+	return &Tracker{
+		timing: Timing{
+			Service: service,
+			Image:   fmt.Sprintf("%s:%s", repository, tag),
+			Start:   now,
+		},
+		phaseAt: now,
+	}
+}
+
+// untrack removes t from the report.
+func untrack(t *Tracker) {
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	for i, tracker := range trackers {
+		if tracker == t {
+			trackers = append(trackers[:i:i], trackers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pull pulls the image if it does not exist yet and records the time spent on pulling. Nothing is recorded if
+// the image exists already.
+func (t *Tracker) Pull(pool *dockertest.Pool, repository, tag string, auth dc.AuthConfiguration) error {
+	pulled := false
+	if _, err := pool.Client.InspectImage(fmt.Sprintf("%s:%s", repository, tag)); err != nil {
+		if err := pool.Client.PullImage(dc.PullImageOptions{
+			Repository: repository,
+			Tag:        tag,
+		}, auth); err != nil {
+			return err
+		}
+		pulled = true
+	}
+	if t != nil {
+		t.mu.Lock()
+		if lap := t.lap(); pulled {
+			t.timing.Pull = lap
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// Created records the time spent on creating and starting the container.
+func (t *Tracker) Created(res *dockertest.Resource) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timing.Create = t.lap()
+	t.timing.Container = res.Container.ID
+	if len(t.timing.Container) > 12 {
+		t.timing.Container = t.timing.Container[:12]
+	}
+}
+
+// Ready records the time spent on waiting the service ready, adds the resource to the report, and starts
+// sampling container stats if enabled.
+func (t *Tracker) Ready(pool *dockertest.Pool, res *dockertest.Resource) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timing.Ready = t.lap()
+
+	trackersMu.Lock()
+	trackers = append(trackers, t)
+	enabled := statsEnabled
+	trackersMu.Unlock()
+	if !enabled {
+		return
+	}
+
+	t.timing.Stats = &Stats{}
+	t.done = make(chan bool)
+	statsc := make(chan *dc.Stats)
+	t.wg.Add(2)
+	go func() {
+		defer t.wg.Done()
+		pool.Client.Stats(dc.StatsOptions{
+			ID:     res.Container.ID,
+			Stats:  statsc,
+			Stream: true,
+			Done:   t.done,
+		})
+	}()
+	go func() {
+		defer t.wg.Done()
+		for s := range statsc {
+			t.sample(s)
+		}
+	}()
+}
+
+// Close calls f (which closes the resource) and records the time spent on it.
+// It also stops sampling container stats.
+func (t *Tracker) Close(f func() error) error {
+	if t == nil {
+		return f()
+	}
+	t.mu.Lock()
+	done := t.done
+	t.done = nil
+	t.mu.Unlock()
+	if done != nil {
+		close(done)
+		t.wg.Wait()
+	}
+
+	start := time.Now()
+	err := f()
+	t.mu.Lock()
+	t.timing.Close = time.Since(start)
+	t.mu.Unlock()
+	return err
+}
+
+// Timing returns a snapshot of the recorded timing.
+func (t *Tracker) Timing() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := t.timing
+	if ret.Stats != nil {
+		stats := *ret.Stats
+		ret.Stats = &stats
+	}
+	return ret
+}
+
+// Must be called with t.mu held.
+func (t *Tracker) lap() time.Duration {
+	now := time.Now()
+	ret := now.Sub(t.phaseAt)
+	t.phaseAt = now
+	return ret
+}
+
+func (t *Tracker) sample(s *dc.Stats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.timing.Stats
+
+	// See https://docs.docker.com/engine/api/v1.41/#operation/ContainerStats
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	cpu := 0.0
+	if cpuDelta > 0 && sysDelta > 0 {
+		cpu = cpuDelta / sysDelta * cpus * 100
+	}
+
+	stats.CPUAvg = (stats.CPUAvg*float64(stats.Samples) + cpu) / float64(stats.Samples+1)
+	stats.Samples++
+	if cpu > stats.CPUMax {
+		stats.CPUMax = cpu
+	}
+	if s.MemoryStats.Usage > stats.MemMax {
+		stats.MemMax = s.MemoryStats.Usage
+	}
+}
+
+// Timings returns snapshots of all recorded timings in the order of resources run.
+func Timings() []Timing {
+	trackersMu.Lock()
+	ts := append([]*Tracker(nil), trackers...)
+	trackersMu.Unlock()
+
+	ret := make([]Timing, 0, len(ts))
+	for _, t := range ts {
+		ret = append(ret, t.Timing())
+	}
+	return ret
+}
+
+// Report writes a text summary of all recorded timings to w.
+func Report(w io.Writer) error {
+	timings := Timings()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tIMAGE\tCONTAINER\tPULL\tCREATE\tREADY\tCLOSE\tTOTAL\tCPU AVG\tCPU MAX\tMEM MAX")
+
+	type sum struct {
+		n     int
+		total time.Duration
+	}
+	services := []string{}
+	sums := map[string]*sum{}
+	for _, t := range timings {
+		total := t.Pull + t.Create + t.Ready + t.Close
+		cpuAvg, cpuMax, memMax := "-", "-", "-"
+		if t.Stats != nil && t.Stats.Samples > 0 {
+			cpuAvg = fmt.Sprintf("%.1f%%", t.Stats.CPUAvg)
+			cpuMax = fmt.Sprintf("%.1f%%", t.Stats.CPUMax)
+			memMax = fmt.Sprintf("%.1fMiB", float64(t.Stats.MemMax)/(1<<20))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.Service, t.Image, t.Container,
+			roundDuration(t.Pull), roundDuration(t.Create), roundDuration(t.Ready), roundDuration(t.Close),
+			roundDuration(total), cpuAvg, cpuMax, memMax)
+
+		s := sums[t.Service]
+		if s == nil {
+			s = &sum{}
+			sums[t.Service] = s
+			services = append(services, t.Service)
+		}
+		s.n++
+		s.total += total
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tRESOURCES\tTOTAL")
+	for _, service := range services {
+		s := sums[service]
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", service, s.n, roundDuration(s.total))
+	}
+	return tw.Flush()
+}
+
+// ReportJSON writes all recorded timings to w as a JSON array.
+func ReportJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Timings())
+}
+
+// Main runs the tests and then writes the report before exit. Use it in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//	  tstsvc.Main(m)
+//	}
+//
+// The report is controlled by environment variables:
+//   - TSTSVC_REPORT: "text" or "json", no report if empty.
+//   - TSTSVC_REPORT_FILE: the report file path, default to stderr.
+func Main(m *testing.M) {
+	code := m.Run()
+	if err := writeReport(os.Getenv("TSTSVC_REPORT"), os.Getenv("TSTSVC_REPORT_FILE")); err != nil {
+		fmt.Fprintf(os.Stderr, "tstsvc: write report error: %s\n", err)
+	}
+	os.Exit(code)
+}
+
+func writeReport(format, path string) error {
+	if format == "" {
+		return nil
+	}
+
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		return ReportJSON(w)
+	case "text":
+		return Report(w)
+	default:
+		return fmt.Errorf("unknown report format %+q", format)
+	}
+}
+
+func roundDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,79 @@
+package tstsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+
+	// No stats sampling for the fake container.
+	trackersMu.Lock()
+	enabled := statsEnabled
+	trackersMu.Unlock()
+	EnableStats(false)
+	defer EnableStats(enabled)
+
+	// Not reported until ready.
+	failed := Track("yyy", "yyy", "1.0")
+	failed.Created(&dockertest.Resource{Container: &dc.Container{ID: "fedcba9876543210"}})
+
+	tracker := Track("xxx", "xxx", "1.0")
+	defer untrack(tracker)
+	time.Sleep(10 * time.Millisecond)
+	res := &dockertest.Resource{Container: &dc.Container{ID: "0123456789abcdef"}}
+	tracker.Created(res)
+	tracker.Ready(DefaultPool(), res)
+	assert.NoError(tracker.Close(func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}))
+
+	timing := tracker.Timing()
+	assert.Equal("xxx", timing.Service)
+	assert.Equal("xxx:1.0", timing.Image)
+	assert.Equal("0123456789ab", timing.Container)
+	assert.True(timing.Create >= 10*time.Millisecond)
+	assert.True(timing.Close >= 10*time.Millisecond)
+	assert.Nil(timing.Stats)
+
+	// Text report.
+	{
+		buf := &bytes.Buffer{}
+		assert.NoError(Report(buf))
+		log.Printf("Report:\n%s", buf.String())
+		assert.Contains(buf.String(), "xxx:1.0")
+		assert.Contains(buf.String(), "0123456789ab")
+		assert.NotContains(buf.String(), "yyy:1.0")
+	}
+
+	// JSON report.
+	{
+		buf := &bytes.Buffer{}
+		assert.NoError(ReportJSON(buf))
+		timings := []Timing{}
+		assert.NoError(json.Unmarshal(buf.Bytes(), &timings))
+		if assert.NotEmpty(timings) {
+			last := timings[len(timings)-1]
+			assert.Equal(timing.Container, last.Container)
+			assert.Equal(timing.Close, last.Close)
+			assert.True(timing.Start.Equal(last.Start))
+		}
+	}
+
+	// Nil tracker.
+	{
+		var tracker *Tracker
+		tracker.Created(nil)
+		tracker.Ready(nil, nil)
+		assert.NoError(tracker.Close(func() error { return nil }))
+	}
+}
@@ -2,6 +2,9 @@ package tststan
 
 import (
 	"fmt"
+	"io"
+	"net/url"
+	"testing"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
@@ -24,6 +27,9 @@ var (
 
 	// Default container expire time.
 	DefaultExpire uint = 120
+
+	// Length of random generated passwords/tokens.
+	RandomPasswordLength = 16
 )
 
 var (
@@ -38,6 +44,8 @@ type Resource struct {
 
 	// Actual options.
 	Options
+
+	tracker *tstsvc.Tracker
 }
 
 // Options is options to run a nats streaming test server.
@@ -48,6 +56,19 @@ type Options struct {
 	// The cluster id of the server. Default: DefaultClusterId.
 	ClusterId string
 
+	// If specified, clients must authenticate with User/Password. Default: "".
+	User string
+
+	// The password of User. Default: "", or a random one if RandomCredentials is true and User is specified.
+	Password string
+
+	// If specified, clients must authenticate with this token. Can't be used with User.
+	// Default: "", or a random one if RandomCredentials is true and User is not specified.
+	Token string
+
+	// If true, generate random password/token per Resource. Default: false.
+	RandomCredentials bool
+
 	// Use FILE store if true and use MEMORY store otherwise.
 	// NOTE: Not support SQL store in this test server.
 	FileStore bool
@@ -96,6 +117,18 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	if opts.ClusterId == "" {
 		opts.ClusterId = DefaultClusterId
 	}
+	if opts.User != "" && opts.Token != "" {
+		return nil, fmt.Errorf("tststan: User and Token can't be both specified")
+	}
+	if opts.RandomCredentials {
+		if opts.User != "" {
+			if opts.Password == "" {
+				opts.Password = tstsvc.RandomString(RandomPasswordLength)
+			}
+		} else if opts.Token == "" {
+			opts.Token = tstsvc.RandomString(RandomPasswordLength)
+		}
+	}
 	if opts.HostPort == 0 {
 		opts.HostPort = tstsvc.FreePort()
 	}
@@ -116,6 +149,11 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 	}
 	runOpts.Tag = opts.Tag
 	runOpts.Cmd = append(runOpts.Cmd, "-cid", opts.ClusterId)
+	if opts.User != "" {
+		runOpts.Cmd = append(runOpts.Cmd, "--user", opts.User, "--pass", opts.Password)
+	} else if opts.Token != "" {
+		runOpts.Cmd = append(runOpts.Cmd, "--auth", opts.Token)
+	}
 	if opts.FileStore {
 		runOpts.Cmd = append(runOpts.Cmd, "-st", "FILE", "--dir", "/data")
 		if opts.HostDataPath != "" {
@@ -137,11 +175,18 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		},
 	}
 
+	// Track timings.
+	res.tracker = tstsvc.Track("stan", runOpts.Repository, runOpts.Tag)
+	if err := res.tracker.Pull(pool, runOpts.Repository, runOpts.Tag, runOpts.Auth); err != nil {
+		return nil, err
+	}
+
 	var err error
 	res.Resource, err = pool.RunWithOptions(&runOpts)
 	if err != nil {
 		return nil, err
 	}
+	res.tracker.Created(res.Resource)
 
 	// Set expire of the container.
 	res.Resource.Expire(opts.Expire)
@@ -163,13 +208,19 @@ func RunFromPool(pool *dockertest.Pool, opts *Options) (*Resource, error) {
 		res.Close()
 		return nil, err
 	}
+	res.tracker.Ready(pool, res.Resource)
 
 	return res, nil
 }
 
-// NatsURL returns the nats url to connect to the nats streaming server.
+// Close removes the container.
+func (res *Resource) Close() error {
+	return res.tracker.Close(res.Resource.Close)
+}
+
+// NatsURL returns the nats url (with credentials if any) to connect to the nats streaming server.
 func (res *Resource) NatsURL() string {
-	return fmt.Sprintf("nats://localhost:%d", res.Options.HostPort)
+	return res.natsURL(fmt.Sprintf("localhost:%d", res.Options.HostPort))
 }
 
 // NatsClient returns a nats client of the embedded nats server of the test nats streaming server.
@@ -177,8 +228,60 @@ func (res *Resource) NatsClient(opts ...nats.Option) (*nats.Conn, error) {
 	return nats.Connect(res.NatsURL(), opts...)
 }
 
+// NetworkNatsURL returns the nats url to connect to the test nats streaming server from another container
+// in the same docker network.
+func (res *Resource) NetworkNatsURL() string {
+	return res.natsURL(fmt.Sprintf("%s:4222", tstsvc.ContainerName(res.Resource)))
+}
+
+func (res *Resource) natsURL(host string) string {
+	u := &url.URL{
+		Scheme: "nats",
+		Host:   host,
+	}
+	if res.Options.User != "" {
+		u.User = url.UserPassword(res.Options.User, res.Options.Password)
+	} else if res.Options.Token != "" {
+		u.User = url.User(res.Options.Token)
+	}
+	return u.String()
+}
+
+// NetworkEnv implements tstsvc.NetworkEnver.
+func (res *Resource) NetworkEnv() map[string]string {
+	return map[string]string{
+		"NATS_URL":        res.NetworkNatsURL(),
+		"STAN_CLUSTER_ID": res.Options.ClusterId,
+	}
+}
+
+// Export implements tstsvc.Exporter.
+func (res *Resource) Export() map[string]string {
+	return map[string]string{
+		"NATS_URL":        res.NatsURL(),
+		"STAN_CLUSTER_ID": res.Options.ClusterId,
+	}
+}
+
 // StanClient returns a stan client of the test nats streaming server identified by clientId.
 func (res *Resource) StanClient(clientId string, opts ...stan.Option) (stan.Conn, error) {
 	opts = append(opts, stan.NatsURL(res.NatsURL()))
 	return stan.Connect(res.Options.ClusterId, clientId, opts...)
 }
+
+// Matrix runs f as a subtest against a test nats streaming server for each tag. tags can be overrided by
+// environment variable TSTSVC_STAN_TAGS (comma separated) and DefaultTag is used if both are empty.
+// opts is used as the base options of each server (with Tag replaced), nil for the default options.
+// If parallel is true, the subtests are run in parallel, in which case HostXXXPort in opts should be zero.
+func Matrix(t *testing.T, tags []string, parallel bool, opts *Options, f func(t *testing.T, res *Resource)) {
+	if opts == nil {
+		opts = defaultOptions
+	}
+	tstsvc.MatrixResources(t, "stan", tags, DefaultTag, parallel, func(tag string) (io.Closer, error) {
+		o := *opts
+		o.Tag = tag
+		return Run(&o)
+	}, func(t *testing.T, res io.Closer) {
+		f(t, res.(*Resource))
+	})
+}
@@ -1,11 +1,13 @@
 package tststan
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"testing"
 
+	"github.com/nats-io/nats.go"
 	stan "github.com/nats-io/stan.go"
 	"github.com/stretchr/testify/assert"
 )
@@ -117,3 +119,46 @@ func TestRun(t *testing.T) {
 	<-handler2c
 	log.Printf("Received previous message.\n")
 }
+
+func TestRandomCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, opts := range []*Options{
+		{RandomCredentials: true},
+		{RandomCredentials: true, User: "tst"},
+	} {
+		res, err := Run(opts)
+		if !assert.NoError(err) {
+			continue
+		}
+		log.Printf("The stan server is up, nats url: %+q.\n", res.NatsURL())
+
+		// Connect with credentials.
+		sc, err := res.StanClient(clientId)
+		if assert.NoError(err) {
+			sc.Close()
+		}
+
+		// Connect without credentials.
+		_, err = stan.Connect(res.Options.ClusterId, clientId, stan.NatsURL(fmt.Sprintf("nats://localhost:%d", res.Options.HostPort)))
+		assert.Error(err)
+
+		// Connect with a wrong password/token.
+		_, err = nats.Connect(fmt.Sprintf("nats://%s@localhost:%d", "wrong", res.Options.HostPort))
+		assert.Error(err)
+
+		res.Close()
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	Matrix(t, nil, false, nil, func(t *testing.T, res *Resource) {
+		sc, err := res.StanClient(clientId)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer sc.Close()
+		assert.NoError(t, sc.Publish(subject, []byte("xxx")))
+		log.Printf("Nats streaming server %s is up, nats url: %+q.\n", res.Options.Tag, res.NatsURL())
+	})
+}
@@ -1,7 +1,9 @@
 package tstsvc
 
 import (
+	"crypto/rand"
 	"log"
+	"math/big"
 	"net"
 
 	"github.com/ory/dockertest/v3"
@@ -34,3 +36,20 @@ func FreePort() uint16 {
 	defer l.Close()
 	return uint16(l.Addr().(*net.TCPAddr).Port)
 }
+
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// RandomString returns a cryptographically random alphanumeric string of length n, which is safe to
+// be used in DSNs/URLs without escaping. It's suitable for per run credentials.
+func RandomString(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(randomStringLetters)))
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = randomStringLetters[idx.Int64()]
+	}
+	return string(b)
+}
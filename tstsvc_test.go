@@ -1,8 +1,14 @@
 package tstsvc
 
 import (
+	"io"
 	"log"
+	"os"
+	"sort"
+	"sync"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRandPort(t *testing.T) {
@@ -10,3 +16,71 @@ func TestRandPort(t *testing.T) {
 		log.Println(FreePort())
 	}
 }
+
+func TestRandomString(t *testing.T) {
+	assert := assert.New(t)
+	s1 := RandomString(16)
+	s2 := RandomString(16)
+	assert.Len(s1, 16)
+	assert.NotEqual(s1, s2)
+	assert.Regexp("^[a-zA-Z0-9]+$", s1)
+}
+
+func TestMatrixTags(t *testing.T) {
+	assert := assert.New(t)
+
+	env := MatrixEnv("xxx")
+	assert.Equal("TSTSVC_XXX_TAGS", env)
+	defer os.Unsetenv(env)
+
+	os.Unsetenv(env)
+	assert.Equal([]string{"1"}, MatrixTags("xxx", nil, "1"))
+	assert.Equal([]string{"2", "3"}, MatrixTags("xxx", []string{"2", "3"}, "1"))
+
+	os.Setenv(env, " 4, ,5 ")
+	assert.Equal([]string{"4", "5"}, MatrixTags("xxx", []string{"2", "3"}, "1"))
+
+	var tags []string
+	Matrix(t, "xxx", nil, "1", false, func(t *testing.T, tag string) {
+		tags = append(tags, tag)
+	})
+	assert.Equal([]string{"4", "5"}, tags)
+}
+
+type fakeResource struct {
+	tag    string
+	closed bool
+}
+
+func (res *fakeResource) Close() error {
+	res.closed = true
+	return nil
+}
+
+func TestMatrixResources(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	resources := []*fakeResource{}
+	t.Run("matrix", func(t *testing.T) {
+		MatrixResources(t, "xxx", []string{"1.0", "2.0"}, "1.0", true, func(tag string) (io.Closer, error) {
+			res := &fakeResource{tag: tag}
+			mu.Lock()
+			resources = append(resources, res)
+			mu.Unlock()
+			return res, nil
+		}, func(t *testing.T, res io.Closer) {
+			r := res.(*fakeResource)
+			assert.Equal("TestMatrixResources/matrix/"+r.tag, t.Name())
+			assert.False(r.closed)
+		})
+	})
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].tag < resources[j].tag })
+	if assert.Len(resources, 2) {
+		assert.Equal("1.0", resources[0].tag)
+		assert.Equal("2.0", resources[1].tag)
+		assert.True(resources[0].closed)
+		assert.True(resources[1].closed)
+	}
+}